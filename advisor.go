@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A plan covers usage comfortably when its limit leaves this much headroom.
+const advisorMargin = 1.2
+
+func planAdvice(r Report, now time.Time) string {
+	if !r.Forecast {
+		setForecast(&r, now)
+	}
+	names := planNames()
+	sort.SliceStable(names, func(i, j int) bool { return plans[names[i]] < plans[names[j]] })
+
+	var b strings.Builder
+	month := r.Period.Format("January 2006")
+	if now.UTC().Year() == r.Period.Year() && now.UTC().Month() == r.Period.Month() {
+		fmt.Fprintf(&b, "At this pace you'll use about %s requests in %s.\n\n", formatCount(r.Projected), month)
+	} else {
+		fmt.Fprintf(&b, "You used %s requests in %s.\n\n", formatCount(r.Projected), month)
+	}
+	fmt.Fprintf(&b, "%-12s %6s  %s\n", "PLAN", "LIMIT", "HEADROOM")
+	var exceeded []string
+	recommended := ""
+	for _, name := range names {
+		limit := float64(plans[name])
+		switch {
+		case r.Projected > limit:
+			fmt.Fprintf(&b, "%-12s %6d  over by %s\n", name, plans[name], formatCount(r.Projected-limit))
+			exceeded = append(exceeded, fmt.Sprintf("%s (%d)", name, plans[name]))
+			continue
+		case r.Projected == 0:
+			fmt.Fprintf(&b, "%-12s %6d  -\n", name, plans[name])
+		default:
+			fmt.Fprintf(&b, "%-12s %6d  %.1fx\n", name, plans[name], limit/r.Projected)
+		}
+		if recommended == "" && limit >= r.Projected*advisorMargin {
+			recommended = name
+		}
+	}
+	b.WriteString("\n")
+
+	if r.Projected == 0 {
+		b.WriteString("No usage yet; every plan covers it.")
+		return b.String()
+	}
+	var advice []string
+	if len(exceeded) > 0 {
+		advice = append(advice, "At this pace you'd exceed "+joinAnd(exceeded))
+	}
+	if recommended != "" {
+		advice = append(advice, fmt.Sprintf("%s (%d) gives %.1fx headroom",
+			recommended, plans[recommended], float64(plans[recommended])/r.Projected))
+	} else {
+		largest := names[len(names)-1]
+		advice = append(advice, fmt.Sprintf("no plan leaves %.0f%% to spare; the largest, %s (%d), gives %.1fx",
+			(advisorMargin-1)*100, largest, plans[largest], float64(plans[largest])/r.Projected))
+	}
+	b.WriteString(capitalize(strings.Join(advice, "; ")) + ".")
+	return b.String()
+}
+
+func joinAnd(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const defaultCacheTTL = 300 * time.Second
+
+// cacheDir is the subdirectory of the cache for the selected profile and gh
+// account; see cacheNamespace.
+var cacheDir string
+
+// cacheRefresh makes every cached lookup fetch live, as with -refresh. The
+// fresh result still overwrites the cache.
+var cacheRefresh bool
+
+type cacheEntry struct {
+	LastFetch time.Time       `json:"last_fetch"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func getCacheTTL(enabled bool, cfg config) time.Duration {
+	if !enabled && !cfg.Cache {
+		return 0
+	}
+	if envTTL := os.Getenv("GH_COPILOT_CACHE_TTL"); envTTL != "" {
+		if parsed, err := strconv.Atoi(envTTL); err == nil && parsed > 0 {
+			return time.Duration(parsed) * time.Second
+		}
+	}
+	if cfg.CacheTTL > 0 {
+		return time.Duration(cfg.CacheTTL) * time.Second
+	}
+	return defaultCacheTTL
+}
+
+func cachePath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "copilot-usage", cacheDir, name+".json"), nil
+}
+
+// cacheNamespace keeps separate caches per profile and per gh account, so a
+// cached username from one -gh-user or gh_config_dir is never reused for
+// another.
+func cacheNamespace(profile, ghUser, ghConfigDir string) string {
+	var parts []string
+	if profile != "" {
+		parts = append(parts, profile)
+	}
+	if ghUser != "" {
+		parts = append(parts, "gh-user-"+ghUser)
+	}
+	if ghConfigDir != "" {
+		sum := sha256.Sum256([]byte(filepath.Clean(ghConfigDir)))
+		parts = append(parts, "gh-config-"+hex.EncodeToString(sum[:6]))
+	}
+	return filepath.Join(parts...)
+}
+
+func readCache(name string, ttl time.Duration, v interface{}) bool {
+	if cacheRefresh {
+		return false
+	}
+	fetched, ok := readCacheEntry(name, v)
+	return ok && clock().Sub(fetched) <= ttl
+}
+
+func readCacheEntry(name string, v interface{}) (time.Time, bool) {
+	path, err := cachePath(name)
+	if err != nil {
+		return time.Time{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.LastFetch.IsZero() {
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(entry.Data, v); err != nil {
+		return time.Time{}, false
+	}
+	return entry.LastFetch, true
+}
+
+func writeCache(name string, v interface{}) error {
+	path, err := cachePath(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(cacheEntry{LastFetch: clock(), Data: data})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o600)
+}
+
+func hostCacheName(host, name string) string {
+	if host == defaultHost {
+		return name
+	}
+	return host + "-" + name
+}
+
+func getUsernameCached(src UsageSource, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return src.Username()
+	}
+	name := hostCacheName(src.Host(), "username")
+	var username string
+	if readCache(name, ttl, &username) && username != "" {
+		vlog.Printf("cache hit: %s", name)
+		return username, nil
+	}
+	vlog.Printf("cache miss: %s", name)
+	username, err := src.Username()
+	if err != nil {
+		return "", err
+	}
+	writeCache(name, username)
+	return username, nil
+}
+
+func fetchUsageCached(src UsageSource, acct Account, year, month, day int, ttl time.Duration) (UsageResponse, time.Time, error) {
+	if ttl <= 0 {
+		usage, err := src.Usage(acct, year, month, day)
+		return usage, clock(), err
+	}
+	name := fmt.Sprintf("usage-%s-%04d-%02d", acct.Name, year, month)
+	if acct.Org {
+		name = fmt.Sprintf("usage-org-%s-%04d-%02d", acct.Name, year, month)
+	}
+	if day > 0 {
+		name += fmt.Sprintf("-%02d", day)
+	}
+	name = hostCacheName(src.Host(), name)
+	var cached UsageResponse
+	fetched, ok := readCacheEntry(name, &cached)
+	if cacheRefresh {
+		ok = false
+	}
+	age := clock().Sub(fetched)
+	if ok && age <= ttl {
+		vlog.Printf("cache hit: %s (fetched %s ago)", name, formatAge(age))
+		return cached, fetched, nil
+	}
+	vlog.Printf("cache miss: %s", name)
+	usage, err := src.Usage(acct, year, month, day)
+	if err != nil {
+		if ok {
+			fmt.Fprintf(os.Stderr, "Warning: using cached usage from %s ago: %v\n", formatAge(age), err)
+			return cached, fetched, nil
+		}
+		return UsageResponse{}, time.Time{}, err
+	}
+	writeCache(name, usage)
+	return usage, clock(), nil
+}
+
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if h := int(d.Hours()); h > 0 {
+		return fmt.Sprintf("%dh%dm", h, int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
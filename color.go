@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	ansiYellow = "\033[33m"
+	ansiRed    = "\033[31m"
+	ansiReset  = "\033[0m"
+)
+
+const (
+	colors16   = 16
+	colors256  = 256
+	colorsTrue = 1 << 24
+)
+
+var (
+	warnThreshold = 75.0
+	critThreshold = 90.0
+	useColor      = false
+	colorDepth    = colors16
+	colorRamp     = true
+)
+
+// colorSetting resolves -color (auto, always, never, 16, 256, truecolor)
+// into whether the box is colored and how many colors the terminal has.
+func colorSetting(mode string, noColor bool, cfg config) (bool, int, error) {
+	if noColor {
+		return false, 0, nil
+	}
+	switch mode {
+	case "auto":
+		return colorEnabled(cfg), detectColorDepth(), nil
+	case "always":
+		return true, detectColorDepth(), nil
+	case "never":
+		return false, 0, nil
+	case "16":
+		return true, colors16, nil
+	case "256":
+		return true, colors256, nil
+	case "truecolor":
+		return true, colorsTrue, nil
+	}
+	return false, 0, fmt.Errorf("invalid -color %q (must be auto, always, never, 16, 256, or truecolor)", mode)
+}
+
+func detectColorDepth() int {
+	switch ct := strings.ToLower(os.Getenv("COLORTERM")); {
+	case ct == "truecolor" || ct == "24bit":
+		return colorsTrue
+	case strings.Contains(os.Getenv("TERM"), "256color"):
+		return colors256
+	}
+	return colors16
+}
+
+func colorEnabled(cfg config) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if cfg.Color != nil && !*cfg.Color {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func rampRGB(pct float64) (red, green int) {
+	t := math.Max(0, math.Min(pct, 100)) / 100
+	r, g := 255.0, 255.0
+	if t < 0.5 {
+		r = t * 2 * 255
+	} else {
+		g = (1 - (t-0.5)*2) * 255
+	}
+	return int(math.Round(r)), int(math.Round(g))
+}
+
+func rampColor(pct float64) string {
+	red, green := rampRGB(pct)
+	return fmt.Sprintf("#%02x%02x00", red, green)
+}
+
+// rampANSI is the terminal escape for the ramp color: 24-bit where
+// supported, otherwise the nearest entry of the xterm 6x6x6 color cube.
+func rampANSI(pct float64) string {
+	red, green := rampRGB(pct)
+	if colorDepth >= colorsTrue {
+		return fmt.Sprintf("\033[38;2;%d;%d;0m", red, green)
+	}
+	cube := func(v int) int { return int(math.Round(float64(v) / 255 * 5)) }
+	return fmt.Sprintf("\033[38;5;%dm", 16+36*cube(red)+6*cube(green))
+}
+
+func statusColor(pct float64, normal, warn, crit string) string {
+	if colorRamp {
+		return rampColor(pct)
+	}
+	switch {
+	case pct >= critThreshold:
+		return crit
+	case pct >= warnThreshold:
+		return warn
+	}
+	return normal
+}
+
+func colorize(s string, pct float64) string {
+	if !useColor {
+		return s
+	}
+	if colorRamp && colorDepth >= colors256 {
+		return rampANSI(pct) + s + ansiReset
+	}
+	switch {
+	case pct >= critThreshold:
+		return ansiRed + s + ansiReset
+	case pct >= warnThreshold:
+		return ansiYellow + s + ansiReset
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type config struct {
+	Plan     string `json:"plan"`
+	Limit    int    `json:"limit"`
+	Output   string `json:"output"`
+	Color    *bool  `json:"color"`
+	Cache    bool   `json:"cache"`
+	CacheTTL int    `json:"cache_ttl"`
+
+	Plans       map[string]int     `json:"plans"`
+	Multipliers map[string]float64 `json:"multipliers"`
+
+	ResetDay int    `json:"reset_day"`
+	ResetTZ  string `json:"reset_tz"`
+
+	GHUser      string `json:"gh_user"`
+	GHConfigDir string `json:"gh_config_dir"`
+
+	Models struct {
+		Aliases map[string]string `json:"aliases"`
+	} `json:"models"`
+
+	Families map[string]string `json:"families"`
+
+	Profiles map[string]config `json:"profiles"`
+}
+
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "copilot-usage", "config.json"), nil
+}
+
+const projectConfigName = ".copilot-usage.json"
+
+// projectConfig is the subset of settings a repository can pin in a
+// .copilot-usage.json file.
+type projectConfig struct {
+	Plan   string `json:"plan"`
+	Limit  int    `json:"limit"`
+	Output string `json:"output"`
+}
+
+// findProjectConfig looks for .copilot-usage.json in dir and each parent,
+// stopping after the home directory or the filesystem root.
+func findProjectConfig(dir string) string {
+	home, _ := os.UserHomeDir()
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if dir == home || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func applyProjectConfig(cfg config, path string) (config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config{}, err
+	}
+	var p projectConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if p.Plan != "" {
+		cfg.Plan = p.Plan
+		cfg.Limit = p.Limit
+	} else if p.Limit != 0 {
+		cfg.Limit = p.Limit
+	}
+	if p.Output != "" {
+		cfg.Output = p.Output
+	}
+	if err := validateConfig(cfg); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func applyPlanOverrides(cfg config) {
+	for name, limit := range cfg.Plans {
+		plans[name] = limit
+	}
+}
+
+func selectProfile(cfg config, name string) (config, error) {
+	if name == "" {
+		return cfg, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return config{}, fmt.Errorf("unknown profile %q (configured profiles: %s)", name, strings.Join(names, ", "))
+	}
+
+	if p.Plan != "" {
+		cfg.Plan = p.Plan
+	}
+	if p.Limit > 0 {
+		cfg.Limit = p.Limit
+	}
+	if p.Output != "" {
+		cfg.Output = p.Output
+	}
+	if p.Color != nil {
+		cfg.Color = p.Color
+	}
+	if p.Cache {
+		cfg.Cache = true
+	}
+	if p.CacheTTL > 0 {
+		cfg.CacheTTL = p.CacheTTL
+	}
+	if p.ResetDay != 0 {
+		cfg.ResetDay = p.ResetDay
+	}
+	if p.ResetTZ != "" {
+		cfg.ResetTZ = p.ResetTZ
+	}
+	if p.GHUser != "" {
+		cfg.GHUser = p.GHUser
+	}
+	if p.GHConfigDir != "" {
+		cfg.GHConfigDir = p.GHConfigDir
+	}
+	if len(p.Multipliers) > 0 {
+		cfg.Multipliers = p.Multipliers
+	}
+	if len(p.Models.Aliases) > 0 {
+		cfg.Models.Aliases = p.Models.Aliases
+	}
+	if len(p.Families) > 0 {
+		cfg.Families = p.Families
+	}
+	if len(p.Plans) > 0 {
+		merged := make(map[string]int, len(cfg.Plans)+len(p.Plans))
+		for n, limit := range cfg.Plans {
+			merged[n] = limit
+		}
+		for n, limit := range p.Plans {
+			merged[n] = limit
+		}
+		cfg.Plans = merged
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return config{}, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return cfg, nil
+}
+
+func loadConfig(path string) (config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			return config{}, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return config{}, nil
+		}
+		return config{}, err
+	}
+
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func validateConfig(cfg config) error {
+	if cfg.Limit < 0 {
+		return errors.New("limit must be positive")
+	}
+	for name, limit := range cfg.Plans {
+		if limit <= 0 {
+			return fmt.Errorf("plan %q must have a positive limit", name)
+		}
+	}
+	if cfg.Plan != "" {
+		_, known := plans[cfg.Plan]
+		_, custom := cfg.Plans[cfg.Plan]
+		if !known && !custom {
+			return fmt.Errorf("unknown plan %q", cfg.Plan)
+		}
+	}
+	for model, m := range cfg.Multipliers {
+		if m < 0 {
+			return fmt.Errorf("multiplier for %q must not be negative", model)
+		}
+	}
+	for model, alias := range cfg.Models.Aliases {
+		if strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("alias for %q must not be empty", model)
+		}
+	}
+	for prefix, family := range cfg.Families {
+		if strings.TrimSpace(prefix) == "" || strings.TrimSpace(family) == "" {
+			return fmt.Errorf("family rule %q: prefix and family must not be empty", prefix)
+		}
+	}
+	if cfg.Output != "" && !validOutputMode(cfg.Output) {
+		return fmt.Errorf("unknown output %q", cfg.Output)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type billingCycle struct {
+	day int
+	loc *time.Location
+}
+
+var cycle = billingCycle{day: 1, loc: time.UTC}
+
+func getBillingCycle(cliDay int, cliTZ string, cfg config) (billingCycle, error) {
+	c := billingCycle{day: 1, loc: time.UTC}
+	day, tz := cfg.ResetDay, cfg.ResetTZ
+	if cliDay != 0 {
+		day = cliDay
+	}
+	if cliTZ != "" {
+		tz = cliTZ
+	}
+	if day != 0 {
+		if day < 1 || day > 28 {
+			return c, fmt.Errorf("invalid reset day %d (must be 1-28)", day)
+		}
+		c.day = day
+	}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return c, fmt.Errorf("invalid reset timezone %q: %w", tz, err)
+		}
+		c.loc = loc
+	}
+	return c, nil
+}
+
+func (c billingCycle) resetFor(period, now time.Time) time.Time {
+	utc := now.UTC()
+	if utc.Year() == period.Year() && utc.Month() == period.Month() {
+		_, end := c.bounds(now)
+		return end
+	}
+	return time.Date(period.Year(), period.Month()+1, c.day, 0, 0, 0, 0, c.loc)
+}
+
+func (c billingCycle) bounds(now time.Time) (start, end time.Time) {
+	now = now.In(c.loc)
+	start = time.Date(now.Year(), now.Month(), c.day, 0, 0, 0, 0, c.loc)
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
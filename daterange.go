@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The usage endpoint filters by year, month and day but has no range
+// parameters, so -since/-until ranges are fetched one day at a time.
+const maxRangeDays = 62
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or RFC3339)", s)
+	}
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func getRange(sinceStr, untilStr string) (since, until time.Time, err error) {
+	today := clock().UTC().Truncate(24 * time.Hour)
+	until = today
+	if untilStr != "" {
+		if until, err = parseDate(untilStr); err != nil {
+			return
+		}
+	}
+	if since, err = parseDate(sinceStr); err != nil {
+		return
+	}
+	switch days := int(until.Sub(since).Hours()/24) + 1; {
+	case until.After(today):
+		err = fmt.Errorf("-until %s is in the future", until.Format("2006-01-02"))
+	case days < 1:
+		err = fmt.Errorf("-since %s is after -until %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
+	case days > maxRangeDays:
+		err = fmt.Errorf("range of %d days is too long (at most %d; use -months for longer periods)", days, maxRangeDays)
+	}
+	return
+}
+
+func rangeLabel(since, until time.Time) string {
+	if since.Equal(until) {
+		return since.Format("Jan 2, 2006")
+	}
+	if since.Year() == until.Year() {
+		return since.Format("Jan 2") + " - " + until.Format("Jan 2, 2006")
+	}
+	return since.Format("Jan 2, 2006") + " - " + until.Format("Jan 2, 2006")
+}
+
+func fetchRange(src UsageSource, acct Account, since, until time.Time, ttl time.Duration) (UsageResponse, error) {
+	n := int(until.Sub(since).Hours()/24) + 1
+	pages := make([]UsageResponse, n)
+	errs := make([]error, n)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, monthWorkers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				day := since.AddDate(0, 0, i)
+				usage, _, err := fetchUsageCached(src, acct, day.Year(), int(day.Month()), day.Day(), ttl)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %w", day.Format("2006-01-02"), usageError(acct, err))
+					continue
+				}
+				pages[i] = usage
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var usage UsageResponse
+	for i, page := range pages {
+		if errs[i] != nil {
+			return UsageResponse{}, errs[i]
+		}
+		usage.User = page.User
+		usage.UsageItems = append(usage.UsageItems, page.UsageItems...)
+	}
+	return usage, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type usageQuery struct {
+	year, month, day int
+}
+
+func monthQueries(end time.Time, n int) []usageQuery {
+	queries := make([]usageQuery, n)
+	for i := range queries {
+		p := end.AddDate(0, i-(n-1), 0)
+		queries[i] = usageQuery{year: p.Year(), month: int(p.Month())}
+	}
+	return queries
+}
+
+func dayQueries(since, until time.Time) []usageQuery {
+	var queries []usageQuery
+	for d := since; !d.After(until); d = d.AddDate(0, 0, 1) {
+		queries = append(queries, usageQuery{year: d.Year(), month: int(d.Month()), day: d.Day()})
+	}
+	return queries
+}
+
+// dryRunCommands lists the requests a run would make, in order, without
+// making them. The login of the authenticated user is shown as {login}.
+func dryRunCommands(noGH bool, host string, auth ghAuth, acct Account, detectPlan bool, queries []usageQuery) []string {
+	_, err := exec.LookPath("gh")
+	useGH := !noGH && err == nil
+
+	var cmds []string
+	add := func(args []string, path string) {
+		if useGH {
+			cmds = append(cmds, shellJoin(append([]string{"gh"}, args...)))
+		} else {
+			cmds = append(cmds, "GET "+apiBaseURL(host)+path)
+		}
+	}
+
+	if useGH && auth.user != "" {
+		cmds = append(cmds, shellJoin(append([]string{"gh"}, auth.tokenArgs(host)...)))
+	}
+	if detectPlan && acct.Org {
+		path, _ := planEndpoint(acct)
+		add(ghAPIArgs(host, path, "-q", ".plan_type"), path)
+	}
+	if acct.Name == "" {
+		add(usernameArgs(host), "/user")
+		acct.Name = "{login}"
+	}
+	for _, q := range queries {
+		add(usageArgs(host, acct, q.year, q.month, q.day), usageEndpoint(acct, q.year, q.month, q.day))
+	}
+	return cmds
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$&?*;|<>()[]{}!#~`") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// defaultFamilies maps lowercase model-name prefixes to a family. The
+// longest matching prefix wins; config "families" entries are merged in.
+var defaultFamilies = map[string]string{
+	"gpt":    "GPT",
+	"claude": "Claude",
+	"o1":     "o-series",
+	"o3":     "o-series",
+	"o4":     "o-series",
+	"gemini": "Gemini",
+	"grok":   "Grok",
+}
+
+const otherFamily = "Other"
+
+func familyRules(overrides map[string]string) map[string]string {
+	rules := make(map[string]string, len(defaultFamilies)+len(overrides))
+	for prefix, family := range defaultFamilies {
+		rules[prefix] = family
+	}
+	for prefix, family := range overrides {
+		rules[strings.ToLower(strings.TrimSpace(prefix))] = family
+	}
+	return rules
+}
+
+func modelFamily(model string, rules map[string]string) string {
+	name := strings.ToLower(strings.TrimSpace(model))
+	family, best := otherFamily, -1
+	for prefix, f := range rules {
+		if len(prefix) > best && strings.HasPrefix(name, prefix) {
+			family, best = f, len(prefix)
+		}
+	}
+	return family
+}
+
+func groupByFamily(modelCounts map[string]float64, rules map[string]string) map[string]float64 {
+	families := make(map[string]float64)
+	for model, count := range modelCounts {
+		families[modelFamily(model, rules)] += count
+	}
+	return families
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+type glyphs struct {
+	topLeft, topRight       string
+	bottomLeft, bottomRight string
+	teeLeft, teeRight       string
+	horiz, vert             string
+	barFull, barEmpty       string
+	barOver, barIncluded    string
+	bullet, times           string
+	ellipsis                string
+}
+
+var unicodeGlyphs = glyphs{
+	topLeft: "┌", topRight: "┐",
+	bottomLeft: "└", bottomRight: "┘",
+	teeLeft: "├", teeRight: "┤",
+	horiz: "─", vert: "│",
+	barFull: "█", barEmpty: "░",
+	barOver: "▓", barIncluded: "▒",
+	bullet: "•", times: "×",
+	ellipsis: "…",
+}
+
+var asciiGlyphs = glyphs{
+	topLeft: "+", topRight: "+",
+	bottomLeft: "+", bottomRight: "+",
+	teeLeft: "+", teeRight: "+",
+	horiz: "-", vert: "|",
+	barFull: "#", barEmpty: ".",
+	barOver: "!", barIncluded: "=",
+	bullet: "-", times: "x",
+	ellipsis: "...",
+}
+
+var boxGlyphs = unicodeGlyphs
+
+func localeIsUTF8() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return true
+}
@@ -1,3 +1,11 @@
 module copilot-usage
 
 go 1.24.4
+
+require (
+	golang.org/x/term v0.36.0
+	golang.org/x/text v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.37.0 // indirect
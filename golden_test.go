@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenNow is the fixed clock for every golden test.
+var goldenNow = time.Date(2025, 10, 14, 12, 0, 0, 0, time.UTC)
+
+// setupRender fixes the clock and resets the globals that renderers read,
+// restoring them when the test ends.
+func setupRender(t *testing.T) {
+	t.Helper()
+	oldClock, oldGlyphs, oldColor := clock, boxGlyphs, useColor
+	oldDecimals, oldPrecision, oldCycle := countDecimals, pctPrecision, cycle
+	t.Cleanup(func() {
+		clock, boxGlyphs, useColor = oldClock, oldGlyphs, oldColor
+		countDecimals, pctPrecision, cycle = oldDecimals, oldPrecision, oldCycle
+	})
+	clock = func() time.Time { return goldenNow }
+	boxGlyphs = unicodeGlyphs
+	useColor = false
+	countDecimals, pctPrecision = 0, 1
+	cycle = billingCycle{day: 1, loc: time.UTC}
+}
+
+// captureOutput returns what fn writes, failing the test if fn fails.
+func captureOutput(t *testing.T, fn func(w io.Writer) error) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := fn(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s (run go test -update to accept):\n--- got\n%s\n--- want\n%s", name, path, got, want)
+	}
+}
+
+func testReport(t *testing.T, fixture string, opts reportOptions) Report {
+	t.Helper()
+	if opts.plan == "" {
+		opts.plan, opts.limit = "pro", plans["pro"]
+	}
+	if opts.period.IsZero() {
+		opts.period = time.Date(goldenNow.Year(), goldenNow.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	if opts.order == "" {
+		opts.order = "count"
+	}
+	if opts.pctOf == "" {
+		opts.pctOf = "limit"
+	}
+	src := &fileSource{path: filepath.Join("testdata", fixture), host: defaultHost}
+	r, err := fetchReport(src, Account{Name: "octocat"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGoldenRenderers(t *testing.T) {
+	for _, mode := range []string{"box", "json", "plain", "csv", "markdown", "waybar"} {
+		t.Run(mode, func(t *testing.T) {
+			setupRender(t)
+			r := testReport(t, "usage.json", reportOptions{})
+			got := captureOutput(t, func(w io.Writer) error { return render(w, mode, r, renderOptions{barWidth: defaultBarWidth}) })
+			checkGolden(t, mode, got)
+		})
+	}
+}
+
+func TestGoldenI3bar(t *testing.T) {
+	setupRender(t)
+	src := &fileSource{path: filepath.Join("testdata", "usage.json"), host: defaultHost}
+	opts := i3barOptions{user: "octocat", width: defaultBarWidth, name: "copilot", instance: "premium-requests", separator: true}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(copilotBlock(src, plans["pro"], 0, opts)); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "i3bar", b.String())
+}
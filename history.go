@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+const historyDays = 14
+
+type historyRecord struct {
+	Date       string  `json:"date"`
+	Account    string  `json:"account"`
+	Used       float64 `json:"used"`
+	Percentage float64 `json:"percentage"`
+	Time       string  `json:"time,omitempty"`
+}
+
+func historyPath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" && runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "copilot-usage", "history.jsonl"), nil
+}
+
+func readHistoryLog(path string) ([]historyRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec historyRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Date == "" {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+func readHistory(path string) ([]historyRecord, error) {
+	log, err := readHistoryLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := map[string]historyRecord{}
+	for _, rec := range log {
+		key := rec.Date + "\x00" + rec.Account
+		if prev, ok := byDay[key]; !ok || rec.Used > prev.Used {
+			byDay[key] = rec
+		}
+	}
+
+	records := make([]historyRecord, 0, len(byDay))
+	for _, rec := range byDay {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Date != records[j].Date {
+			return records[i].Date < records[j].Date
+		}
+		return records[i].Account < records[j].Account
+	})
+	return records, nil
+}
+
+func logHistory(r Report, now time.Time) error {
+	if utc := now.UTC(); r.Period.Year() != utc.Year() || r.Period.Month() != utc.Month() {
+		return fmt.Errorf("only the current month can be logged")
+	}
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	rec := newHistoryRecord(r, now)
+	for _, prev := range records {
+		if prev.Date == rec.Date && prev.Account == rec.Account && prev.Used >= rec.Used {
+			return nil
+		}
+	}
+	return appendHistory(path, rec)
+}
+
+func newHistoryRecord(r Report, now time.Time) historyRecord {
+	return historyRecord{
+		Date:       now.UTC().Format("2006-01-02"),
+		Account:    r.Username,
+		Used:       r.Used,
+		Percentage: roundPct(r.Percentage),
+		Time:       now.UTC().Format(time.RFC3339),
+	}
+}
+
+func appendHistory(path string, rec historyRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func historyDelta(r Report, now time.Time) (string, error) {
+	if utc := now.UTC(); r.Period.Year() != utc.Year() || r.Period.Month() != utc.Month() {
+		return "", fmt.Errorf("only the current month can be compared")
+	}
+	path, err := historyPath()
+	if err != nil {
+		return "", err
+	}
+	log, err := readHistoryLog(path)
+	if err != nil {
+		return "", err
+	}
+
+	var last *historyRecord
+	for i := range log {
+		if log[i].Account == r.Username && log[i].Time != "" {
+			last = &log[i]
+		}
+	}
+	if err := appendHistory(path, newHistoryRecord(r, now)); err != nil {
+		return "", err
+	}
+
+	if last == nil {
+		return fmt.Sprintf("+%s (first run)", formatCount(r.Used)), nil
+	}
+	at, err := time.Parse(time.RFC3339, last.Time)
+	if err != nil {
+		return "", err
+	}
+	if at.UTC().Month() != now.UTC().Month() || at.UTC().Year() != now.UTC().Year() {
+		return fmt.Sprintf("+%s (since the monthly reset)", formatCount(r.Used)), nil
+	}
+	return fmt.Sprintf("%+.*f in %s", countDecimals, roundCount(r.Used)-roundCount(last.Used), formatAge(now.Sub(at))), nil
+}
+
+func showHistory() error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Printf("No history yet; run with -log to record usage to %s\n", path)
+		return nil
+	}
+	if len(records) > historyDays {
+		records = records[len(records)-historyDays:]
+	}
+
+	fmt.Printf("%-10s  %-20s %8s %7s\n", "DATE", "ACCOUNT", "USED", "%")
+	for _, rec := range records {
+		fmt.Printf("%-10s  %s %8s %6s%%  %s\n",
+			rec.Date, truncateWidth(rec.Account, 20), formatQuantity(rec.Used), formatPct(rec.Percentage), rampGlyph(rec.Percentage))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// aheadOfUTC is early on Nov 1 in UTC+14, when it is still Oct 31 in UTC
+// and the October billing month is current.
+var aheadOfUTC = time.Date(2025, 11, 1, 5, 0, 0, 0, time.FixedZone("UTC+14", 14*3600))
+
+func historyReport(used float64) Report {
+	return Report{Username: "octocat", Period: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), Used: used, Limit: 300}
+}
+
+func TestLogHistoryUsesUTC(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if err := logHistory(historyReport(42), aheadOfUTC); err != nil {
+		t.Fatalf("logHistory: %v", err)
+	}
+	path, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Date != "2025-10-31" {
+		t.Errorf("records = %+v, want one dated 2025-10-31", records)
+	}
+}
+
+func TestHistoryDeltaUsesUTC(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	got, err := historyDelta(historyReport(42), aheadOfUTC)
+	if err != nil {
+		t.Fatalf("historyDelta: %v", err)
+	}
+	if want := "+42 (first run)"; got != want {
+		t.Errorf("historyDelta = %q, want %q", got, want)
+	}
+}
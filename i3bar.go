@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const statusRefresh = 60 * time.Second
+
+type i3barOptions struct {
+	bin       string
+	config    string
+	only      bool
+	org       string
+	user      string
+	width     int
+	name      string
+	instance  string
+	minWidth  string
+	separator bool
+	urgent    bool
+	aliases   map[string]string
+}
+
+func getI3StatusBin(cliBin string) string {
+	if cliBin != "" {
+		return cliBin
+	}
+	if envBin := os.Getenv("GH_COPILOT_I3STATUS_BIN"); envBin != "" {
+		return envBin
+	}
+	return "i3status"
+}
+
+func getI3Standalone(cliStandalone bool) bool {
+	if cliStandalone {
+		return true
+	}
+	standalone, err := strconv.ParseBool(os.Getenv("GH_COPILOT_I3_STANDALONE"))
+	return err == nil && standalone
+}
+
+func getI3StatusConfig(cliConfig string) string {
+	if cliConfig != "" {
+		return cliConfig
+	}
+	if envConfig := os.Getenv("GH_COPILOT_I3STATUS_CONFIG"); envConfig != "" {
+		return envConfig
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "i3status", "config")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func runI3BarMode(src UsageSource, limit int, ttl time.Duration, opts i3barOptions) error {
+	if ttl <= 0 {
+		ttl = statusRefresh
+	}
+
+	// Report a closed stdout as EPIPE instead of being killed by SIGPIPE.
+	signal.Ignore(syscall.SIGPIPE)
+	writeLine(`{"version":1,"click_events":true}`)
+	writeLine("[")
+
+	go handleClicks(os.Stdin, opts, billingURL(src.Host(), Account{Name: opts.org, Org: opts.org != ""}))
+
+	if opts.only {
+		return runI3BarOnly(src, limit, ttl, opts)
+	}
+
+	var args []string
+	if opts.config != "" {
+		args = append(args, "-c", opts.config)
+	}
+	cmd := exec.Command(opts.bin, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer cmd.Wait()
+
+	scanner := bufio.NewScanner(stdout)
+	first := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = strings.TrimSpace(line)
+
+		if line == "" || line == `[` || line == `{"version":1}` {
+			continue
+		}
+
+		isContinuation := strings.HasPrefix(line, ",")
+		if isContinuation {
+			line = line[1:]
+		}
+
+		block := copilotBlock(src, limit, ttl, opts)
+
+		var items []map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &items); err == nil {
+			newItems := append([]map[string]interface{}{block}, items...)
+			output, _ := json.Marshal(newItems)
+
+			if first {
+				writeLine(string(output))
+				first = false
+			} else {
+				writeLine("," + string(output))
+			}
+		} else {
+			if first {
+				writeLine(line)
+				first = false
+			} else {
+				writeLine("," + line)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func runI3BarOnly(src UsageSource, limit int, ttl time.Duration, opts i3barOptions) error {
+	ticker := time.NewTicker(statusRefresh)
+	defer ticker.Stop()
+
+	first := true
+	for {
+		output, _ := json.Marshal([]map[string]interface{}{copilotBlock(src, limit, ttl, opts)})
+		if first {
+			writeLine(string(output))
+			first = false
+		} else {
+			writeLine("," + string(output))
+		}
+		<-ticker.C
+	}
+}
+
+type clickEvent struct {
+	Name     string `json:"name"`
+	Instance string `json:"instance"`
+	Button   int    `json:"button"`
+}
+
+func handleClicks(r io.Reader, opts i3barOptions, url string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), ",")
+		var ev clickEvent
+		if json.Unmarshal([]byte(line), &ev) != nil {
+			continue
+		}
+		if ev.Name == opts.name && ev.Instance == opts.instance && ev.Button == 1 {
+			if err := openBrowser(url); err != nil {
+				fmt.Fprintln(os.Stderr, "Error opening billing page:", err)
+			}
+		}
+	}
+}
+
+func copilotBlock(src UsageSource, limit int, ttl time.Duration, opts i3barOptions) map[string]interface{} {
+	unavailable := opts.block(map[string]interface{}{
+		"full_text":  "Copilot: unavailable",
+		"short_text": "Copilot: n/a",
+		"color":      "#888888",
+	})
+
+	acct, err := resolveAccount(src, opts.org, opts.user, ttl)
+	if err != nil {
+		return unavailable
+	}
+	now := clock().UTC()
+	usage, _, err := fetchUsageCached(src, acct, now.Year(), int(now.Month()), 0, ttl)
+	if err != nil {
+		return unavailable
+	}
+
+	totalUsage := calculateTotalUsage(usage.UsageItems)
+	percentage := percentOf(totalUsage, limit)
+
+	bar := drawBar(totalUsage, float64(limit), opts.width, boxGlyphs)
+
+	// Keys starting with an underscore are ignored by i3bar but passed on to
+	// click handlers and bar replacements such as i3blocks or swaybar.
+	models := sortedModels(aggregateModels(usage.UsageItems, false, opts.aliases), limit, "count")
+	block := opts.block(map[string]interface{}{
+		"full_text":  fmt.Sprintf("Copilot: %s %s%%", bar, formatPct(percentage)),
+		"short_text": formatPct(percentage) + "%",
+		"color":      statusColor(percentage, "#00FF00", "#FFB52A", "#FF5555"),
+		"_used":      math.Round(totalUsage*100) / 100,
+		"_limit":     limit,
+		"_models":    roundedModels(models),
+	})
+	if opts.urgent && percentage >= critThreshold {
+		block["urgent"] = true
+	}
+	return block
+}
+
+func (opts i3barOptions) block(fields map[string]interface{}) map[string]interface{} {
+	fields["name"] = opts.name
+	fields["instance"] = opts.instance
+	if opts.minWidth != "" {
+		if px, err := strconv.Atoi(opts.minWidth); err == nil {
+			fields["min_width"] = px
+		} else {
+			fields["min_width"] = opts.minWidth
+		}
+	}
+	if !opts.separator {
+		fields["separator"] = false
+	}
+	return fields
+}
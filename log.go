@@ -0,0 +1,13 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+var vlog = log.New(io.Discard, "copilot-usage: ", log.Ltime|log.Lmicroseconds)
+
+func enableVerbose() {
+	vlog.SetOutput(os.Stderr)
+}
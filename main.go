@@ -1,28 +1,152 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
-	"os/exec"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	"unicode"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+	"gopkg.in/yaml.v3"
 )
 
 type UsageItem struct {
-	GrossQuantity float64 `json:"grossQuantity"`
-	Model         string  `json:"model"`
+	GrossQuantity    float64 `json:"grossQuantity"`
+	GrossAmount      float64 `json:"grossAmount"`
+	DiscountQuantity float64 `json:"discountQuantity"`
+	DiscountAmount   float64 `json:"discountAmount"`
+	NetQuantity      float64 `json:"netQuantity"`
+	NetAmount        float64 `json:"netAmount"`
+	PricePerUnit     float64 `json:"pricePerUnit"`
+	Model            string  `json:"model"`
 }
 
 type UsageResponse struct {
+	User       string      `json:"user"`
 	UsageItems []UsageItem `json:"usageItems"`
 }
 
+type ModelUsage struct {
+	Model      string  `json:"model" yaml:"model"`
+	Count      float64 `json:"count" yaml:"count"`
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+}
+
+type Report struct {
+	Username   string
+	Org        bool
+	Plan       string
+	Limit      int
+	Used       float64
+	Net        float64
+	NetAmount  float64
+	Billed     float64
+	Weighted   bool
+	Percentage float64
+	Period     time.Time
+	ResetAt    time.Time
+	Models     []ModelUsage
+	ByFamily   bool
+	Since      time.Time
+	Until      time.Time
+	Hidden     int
+	HiddenUsed float64
+	HiddenPct  float64
+	Previous   *Report
+
+	Price       float64
+	Overage     float64
+	OverageCost float64
+
+	Forecast  bool
+	Projected float64
+
+	FetchedAt time.Time
+	Stale     bool
+}
+
+type reportOptions struct {
+	plan        string
+	limit       int
+	period      time.Time
+	order       string
+	price       float64
+	forecast    bool
+	compare     bool
+	ttl         time.Duration
+	include     []string
+	exclude     []string
+	pctOf       string
+	minPct      float64
+	top         int
+	rawModels   bool
+	multipliers map[string]float64
+	aliases     map[string]string
+	families    map[string]string
+}
+
+type renderOptions struct {
+	quietField  string
+	bar         bool
+	barWidth    int
+	csvMeta     bool
+	warnColor   string
+	critColor   string
+	jsonCompact bool
+	fields      []string
+	noModels    bool
+	template    *template.Template
+}
+
 const version = "1.0.0"
 
+const (
+	exitOK        = 0
+	exitThreshold = 1
+	exitError     = 2
+)
+
+const defaultOveragePrice = 0.04
+
+const defaultBarWidth = 10
+
+const (
+	defaultPlan  = "pro+"
+	planCacheTTL = 24 * time.Hour
+)
+
+const (
+	defaultBoxWidth = 58
+	modelBarWidth   = 10
+	minBoxWidth     = 40
+	boxMargin       = 2
+)
+
+var outputModes = []string{"box", "json", "plain", "prometheus", "waybar", "compact", "csv", "yaml", "polybar", "markdown", "quiet", "xbar", "sketchybar", "bar", "ndjson"}
+
+// clock is the source of the current time for everything the tool renders.
+var clock = time.Now
+
+var (
+	countDecimals = 0
+	pctPrecision  = 1
+)
+
 var plans = map[string]int{
 	"free":       50,
 	"pro":        300,
@@ -33,15 +157,124 @@ var plans = map[string]int{
 
 func main() {
 	var (
-		planFlag    = flag.String("plan", "", "Copilot plan (free, pro, pro+, business, enterprise)")
-		limitFlag   = flag.Int("limit", 0, "Custom request limit")
-		jsonFlag    = flag.Bool("json", false, "Output JSON")
-		i3barFlag   = flag.Bool("i3bar", false, "Output i3bar JSON protocol")
-		helpFlag    = flag.Bool("help", false, "Show help")
-		versionFlag = flag.Bool("version", false, "Show version")
+		planFlag     = flag.String("plan", "", "Copilot plan (free, pro, pro+, business, enterprise)")
+		limitFlag    = flag.Int("limit", 0, "Custom request limit")
+		jsonFlag     = flag.Bool("json", false, "Output JSON")
+		jsonCFlag    = flag.Bool("json-compact", false, "Output JSON on a single line")
+		fieldsFlag   = flag.String("fields", "", "Comma-separated JSON fields to output (default all)")
+		schemaFlag   = flag.Bool("schema", false, "Print the JSON Schema of the -json output")
+		plainFlag    = flag.Bool("plain", false, "Output plain key=value lines")
+		promFlag     = flag.Bool("prometheus", false, "Output Prometheus text exposition format")
+		waybarFlag   = flag.Bool("waybar", false, "Output a waybar custom module JSON object")
+		compactFlag  = flag.Bool("compact", false, "Output a single summary line")
+		barFlag      = flag.Bool("bar", false, "Include a usage bar in -compact output")
+		barOnlyFlag  = flag.Bool("bar-only", false, "Print only the usage bar")
+		barFullFlag  = flag.String("bar-full", "", "Glyph for the used part of usage bars")
+		barEmptyFlag = flag.String("bar-empty", "", "Glyph for the unused part of usage bars")
+		barInclFlag  = flag.String("bar-included", "", "Glyph for included (non-billable) usage in the box bar")
+		barWidthFlag = flag.Int("bar-width", defaultBarWidth, "Width of the -compact, -bar-only and -i3bar usage bars")
+		csvFlag      = flag.Bool("csv", false, "Output per-model usage as CSV")
+		yamlFlag     = flag.Bool("yaml", false, "Output YAML")
+		quietFlag    = flag.Bool("quiet", false, "Print only the usage percentage")
+		qFieldFlag   = flag.String("quiet-field", "pct", "Value printed by -quiet (used, limit, pct)")
+		mdFlag       = flag.Bool("markdown", false, "Output a GitHub-flavored markdown table")
+		polybarFlag  = flag.Bool("polybar", false, "Output a polybar line with color tags")
+		pbWarnFlag   = flag.String("polybar-warn-color", "#ffb52a", "Polybar color at the -warn threshold")
+		scaleFlag    = flag.String("color-scale", "ramp", "Status bar colors: ramp (green to red) or threshold (-warn/-crit)")
+		pbCritFlag   = flag.String("polybar-crit-color", "#ff5555", "Polybar color at the -crit threshold")
+		xbarFlag     = flag.Bool("xbar", false, "Output an xbar/BitBar plugin menu")
+		sketchyFlag  = flag.Bool("sketchybar", false, "Output key=value pairs for sketchybar --set")
+		ndjsonFlag   = flag.Bool("ndjson", false, "Output one flat JSON object per line for log shipping")
+		templateFlag = flag.String("template", "", "Format the report with a Go text/template")
+		csvMetaFlag  = flag.Bool("csv-meta", false, "Prefix -csv output with # comment lines for user, plan and month")
+		compareFlag  = flag.Bool("compare", false, "Compare against the previous month")
+		priceFlag    = flag.Float64("price", defaultOveragePrice, "Dollars per premium request over the limit")
+		forecastFlag = flag.Bool("forecast", false, "Project end-of-month usage from the current pace")
+		asciiFlag    = flag.Bool("ascii", false, "Draw the box with ASCII characters only")
+		noColorFlag  = flag.Bool("no-color", false, "Disable colored output")
+		colorFlag    = flag.String("color", "auto", "Colored box output: auto, always, never, 16, 256, truecolor")
+		warnFlag     = flag.Float64("warn", warnThreshold, "Usage percentage shown as a warning")
+		critFlag     = flag.Float64("crit", critThreshold, "Usage percentage shown as critical")
+		modelsFlag   = flag.String("models", "", "Only show models matching these comma-separated substrings")
+		noModelsFlag = flag.Bool("no-models", false, "Hide the per-model breakdown in the box, JSON and YAML output")
+		rawFlag      = flag.Bool("raw-models", false, "List model names exactly as returned by the API, without merging case variants")
+		excludeFlag  = flag.String("exclude-models", "", "Hide models matching these comma-separated substrings")
+		decFlag      = flag.Int("decimals", 0, "Decimal places shown for request counts (0-2)")
+		precFlag     = flag.Int("precision", 1, "Decimal places shown for percentages (0-4)")
+		groupFlag    = flag.String("group-by", "model", "List usage per model or per model family (model, family)")
+		sortFlag     = flag.String("sort", "count", "Per-model sort order (count, name, pct)")
+		minPctFlag   = flag.Float64("min-pct", 0, "Hide models below this percentage from the per-model list")
+		topFlag      = flag.Int("top", 0, "Show only the N busiest models and sum the rest (0 shows all)")
+		pctOfFlag    = flag.String("pct-of", "limit", "Denominator for per-model percentages (limit, used)")
+		threshFlag   = flag.Float64("threshold", 0, "Exit non-zero when usage percentage reaches this value (0-100)")
+		exitFlag     = flag.Int("exit-code", exitThreshold, "Exit code to use when -threshold is reached")
+		gateFlag     = flag.String("gate", "current", "Usage compared with -threshold for the exit code (current, projected)")
+		notifyFlag   = flag.Bool("notify", false, "Send a desktop notification when usage crosses -threshold")
+		notifyCmd    = flag.String("notify-cmd", "", "Notification command; the title and message are appended as arguments")
+		i3barFlag    = flag.Bool("i3bar", false, "Output i3bar JSON protocol")
+		i3binFlag    = flag.String("i3status-bin", "", "i3status binary to wrap in -i3bar mode")
+		i3confFlag   = flag.String("i3status-config", "", "i3status config file to use in -i3bar mode")
+		i3nameFlag   = flag.String("i3bar-name", "copilot", "Block name in -i3bar mode")
+		i3instFlag   = flag.String("i3bar-instance", "premium-requests", "Block instance in -i3bar mode")
+		i3minFlag    = flag.String("i3bar-min-width", "", "Block min_width in -i3bar mode, in pixels or as sample text")
+		i3sepFlag    = flag.Bool("i3bar-separator", true, "Draw a separator after the -i3bar block")
+		i3urgentFlag = flag.Bool("i3bar-urgent", false, "Mark the -i3bar block urgent at the -crit threshold")
+		i3onlyFlag   = flag.Bool("i3bar-only", false, "Emit only the Copilot block in i3bar protocol, without i3status")
+		i3soloFlag   = flag.Bool("i3-standalone", false, "Same as -i3bar-only (also GH_COPILOT_I3_STANDALONE=1)")
+		cacheFlag    = flag.Bool("cache", false, "Cache gh api results between runs")
+		refreshFlag  = flag.Bool("refresh", false, "Ignore cached results and fetch live, updating the cache")
+		noCacheFlag  = flag.Bool("no-cache", false, "Same as -refresh")
+		noGHFlag     = flag.Bool("no-gh", false, "Call the GitHub API directly using GITHUB_TOKEN instead of gh")
+		retriesFlag  = flag.Int("retries", 0, "Attempts for the usage request (default 3)")
+		delayFlag    = flag.Duration("retry-delay", defaultRetryDelay, "Initial delay between attempts, doubled each retry")
+		timeoutFlag  = flag.Duration("timeout", defaultTimeout, "Maximum time to wait for each GitHub request")
+		dryRunFlag   = flag.Bool("dry-run", false, "Print the gh commands that would run, without running them")
+		yearFlag     = flag.Int("year", 0, "Billing year (default: current year)")
+		monthFlag    = flag.Int("month", 0, "Billing month 1-12 (default: current month)")
+		monthsFlag   = flag.Int("months", 0, "Summarize the last N months up to -month")
+		sinceFlag    = flag.String("since", "", "Start of a date range to report (YYYY-MM-DD)")
+		untilFlag    = flag.String("until", "", "End of the -since range, inclusive (default today)")
+		yearSumFlag  = flag.Bool("year-summary", false, "Total usage for every month of -year so far")
+		configFlag   = flag.String("config", "", "Path to config file")
+		profileFlag  = flag.String("profile", "", "Use a named profile from the config file")
+		ghUserFlag   = flag.String("gh-user", "", "Run gh api as this logged-in gh account")
+		inputFlag    = flag.String("input", "", "Read a saved usage API response from this file (- for stdin)")
+		watchFlag    = flag.Bool("watch", false, "Redraw the output on an interval until interrupted")
+		outputFlag   = flag.String("output", "", "Write the output to this file instead of stdout")
+		resetDayFlag = flag.Int("reset-day", 0, "Day of the month usage resets; moves only the reset line and countdown (default 1)")
+		resetTZFlag  = flag.String("reset-tz", "", "Timezone of the usage reset, e.g. America/New_York (default UTC)")
+		intervalFlag = flag.Duration("interval", 60*time.Second, "Refresh interval for -watch")
+		hostFlag     = flag.String("host", "", "GitHub hostname, e.g. for GitHub Enterprise (default github.com)")
+		orgFlag      = flag.String("org", "", "Query an organization's usage instead of your own")
+		userFlag     = flag.String("user", "", "Query another user's usage (requires billing access)")
+		openFlag     = flag.Bool("open", false, "Open the billing settings page in a browser")
+		logFlag      = flag.Bool("log", false, "Append today's usage to the history log")
+		deltaFlag    = flag.Bool("delta", false, "Print the change in usage since the last history log entry")
+		advisorFlag  = flag.Bool("plan-advisor", false, "Suggest the smallest plan that covers the current pace")
+		historyFlag  = flag.Bool("history", false, "Show recent days from the history log")
+		listFlag     = flag.Bool("list-plans", false, "List known plans and their request limits")
+		verboseFlag  = flag.Bool("verbose", false, "Log gh commands, requests, timings and cache use to stderr")
+		nowFlag      = flag.String("now", "", "Pretend the current time is this RFC3339 timestamp (for debugging)")
+		helpFlag     = flag.Bool("help", false, "Show help")
+		versionFlag  = flag.Bool("version", false, "Show version")
+		updateFlag   = flag.Bool("check-update", false, "Check GitHub for a newer release")
 	)
 	flag.Parse()
 
+	if *verboseFlag {
+		enableVerbose()
+	}
+
+	if *nowFlag != "" {
+		t, err := time.Parse(time.RFC3339, *nowFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -now %q (must be RFC3339, e.g. 2025-01-31T23:59:00Z)\n", *nowFlag)
+			os.Exit(exitError)
+		}
+		clock = func() time.Time { return t }
+		vlog.Printf("clock fixed at %s", t.Format(time.RFC3339))
+	}
+
 	if *versionFlag {
 		fmt.Println("copilot-usage", version, "(Go)")
 		return
@@ -52,135 +285,594 @@ func main() {
 		return
 	}
 
-	plan := getPlan(*planFlag)
-	limit := getLimit(*limitFlag, plan)
+	if *schemaFlag {
+		outputSchema()
+		return
+	}
+
+	if *timeoutFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: -timeout must be positive")
+		os.Exit(exitError)
+	}
 
-	if *i3barFlag {
-		runI3BarMode(plan, limit)
+	if *updateFlag {
+		checkUpdate(*timeoutFlag)
 		return
 	}
 
-	username, err := getUsername()
+	cfg, err := loadConfig(*configFlag)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		os.Exit(exitError)
 	}
-	usage, err := fetchUsage(username)
+
+	cfg, err = selectProfile(cfg, *profileFlag)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+	ghUser := cfg.GHUser
+	if *ghUserFlag != "" {
+		ghUser = *ghUserFlag
 	}
+	cacheDir = cacheNamespace(*profileFlag, ghUser, cfg.GHConfigDir)
+	cacheRefresh = *refreshFlag || *noCacheFlag
+	applyPlanOverrides(cfg)
 
-	totalUsage := calculateTotalUsage(usage.UsageItems)
-	percentage := (totalUsage / float64(limit)) * 100
+	if wd, err := os.Getwd(); err == nil {
+		if path := findProjectConfig(wd); path != "" {
+			vlog.Printf("project config %s", path)
+			if cfg, err = applyProjectConfig(cfg, path); err != nil {
+				fmt.Fprintln(os.Stderr, "Error loading config:", err)
+				os.Exit(exitError)
+			}
+		}
+	}
 
-	if *jsonFlag {
-		outputJSON(username, plan, limit, totalUsage, percentage, usage.UsageItems)
+	if *listFlag {
+		listPlans()
 		return
 	}
 
-	printBox(username, plan, limit, totalUsage, percentage, usage.UsageItems)
-}
+	if *historyFlag {
+		if err := showHistory(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading history:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
 
-func runI3BarMode(plan string, limit int) {
-	fmt.Println(`{"version":1}`)
-	fmt.Println("[")
-	os.Stdout.Sync()
+	plan, err := getPlan(*planFlag, *limitFlag, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+	cacheTTL := getCacheTTL(*cacheFlag, cfg)
+	mode := getOutputMode(cfg, map[string]bool{
+		"json":       *jsonFlag || *jsonCFlag || *fieldsFlag != "",
+		"plain":      *plainFlag,
+		"prometheus": *promFlag,
+		"waybar":     *waybarFlag,
+		"compact":    *compactFlag,
+		"csv":        *csvFlag,
+		"yaml":       *yamlFlag,
+		"polybar":    *polybarFlag,
+		"markdown":   *mdFlag,
+		"quiet":      *quietFlag,
+		"xbar":       *xbarFlag,
+		"sketchybar": *sketchyFlag,
+		"bar":        *barOnlyFlag,
+		"ndjson":     *ndjsonFlag,
+	})
 
-	username, usernameErr := getUsername()
+	var tmpl *template.Template
+	if *templateFlag != "" {
+		if tmpl, err = parseTemplate(*templateFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid -template:", err)
+			os.Exit(exitError)
+		}
+		mode = "template"
+	}
 
-	cmd := exec.Command("i3status", "-c", "/home/chope/.config/i3status/config")
-	stdout, err := cmd.StdoutPipe()
+	period, err := getPeriod(*yearFlag, *monthFlag)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error starting i3status:", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
 	}
 
-	if err := cmd.Start(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error starting i3status:", err)
-		os.Exit(1)
+	if *threshFlag < 0 || *threshFlag > 100 {
+		fmt.Fprintf(os.Stderr, "Error: invalid threshold %g (must be 0-100)\n", *threshFlag)
+		os.Exit(exitError)
 	}
-	defer cmd.Wait()
 
-	scanner := bufio.NewScanner(stdout)
-	first := true
-	lastFetch := time.Time{}
-	var cachedItem map[string]interface{}
+	cycle, err = getBillingCycle(*resetDayFlag, *resetTZFlag, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
+	if *gateFlag != "current" && *gateFlag != "projected" {
+		fmt.Fprintf(os.Stderr, "Error: invalid -gate %q (must be current or projected)\n", *gateFlag)
+		os.Exit(exitError)
+	}
 
-		if line == "" || line == `[` || line == `{"version":1}` {
-			continue
-		}
+	if *notifyFlag && *threshFlag == 0 {
+		fmt.Fprintln(os.Stderr, "Error: -notify requires -threshold")
+		os.Exit(exitError)
+	}
+	if flagPassed("notify-cmd") && strings.TrimSpace(*notifyCmd) == "" {
+		fmt.Fprintln(os.Stderr, "Error: -notify-cmd must not be empty")
+		os.Exit(exitError)
+	}
 
-		isContinuation := strings.HasPrefix(line, ",")
-		if isContinuation {
-			line = line[1:]
+	if *warnFlag > *critFlag {
+		fmt.Fprintf(os.Stderr, "Error: -warn (%g) must not be greater than -crit (%g)\n", *warnFlag, *critFlag)
+		os.Exit(exitError)
+	}
+	warnThreshold, critThreshold = *warnFlag, *critFlag
+	switch *scaleFlag {
+	case "ramp", "threshold":
+		colorRamp = *scaleFlag == "ramp"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid -color-scale %q (must be ramp or threshold)\n", *scaleFlag)
+		os.Exit(exitError)
+	}
+	useColor, colorDepth, err = colorSetting(*colorFlag, *noColorFlag, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+	if *colorFlag == "auto" && *outputFlag != "" {
+		useColor = false
+	}
+	if *asciiFlag || !localeIsUTF8() {
+		boxGlyphs = asciiGlyphs
+	}
+	for _, glyph := range []struct{ name, value string }{
+		{"bar-full", *barFullFlag}, {"bar-empty", *barEmptyFlag}, {"bar-included", *barInclFlag},
+	} {
+		if glyph.value != "" && displayWidth(glyph.value) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -%s must be a single-column character, got %q\n", glyph.name, glyph.value)
+			os.Exit(exitError)
 		}
+	}
+	if *barFullFlag != "" {
+		boxGlyphs.barFull = *barFullFlag
+	}
+	if *barEmptyFlag != "" {
+		boxGlyphs.barEmpty = *barEmptyFlag
+	}
+	if *barInclFlag != "" {
+		boxGlyphs.barIncluded = *barInclFlag
+	}
+	if *barWidthFlag < 1 || *barWidthFlag > 100 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -bar-width %d (must be 1-100)\n", *barWidthFlag)
+		os.Exit(exitError)
+	}
 
-		if time.Since(lastFetch) > 60*time.Second || cachedItem == nil {
-			if username == "" || usernameErr != nil {
-				username, usernameErr = getUsername()
-			}
-			if usernameErr != nil {
-				cachedItem = map[string]interface{}{
-					"name":      "copilot",
-					"full_text": "Copilot: unavailable",
-					"color":     "#888888",
-				}
-			} else {
-				usage, err := fetchUsage(username)
-				if err != nil {
-					cachedItem = map[string]interface{}{
-						"name":      "copilot",
-						"full_text": "Copilot: unavailable",
-						"color":     "#888888",
-					}
-				} else {
-					totalUsage := calculateTotalUsage(usage.UsageItems)
-					percentage := (totalUsage / float64(limit)) * 100
-
-					filled := int(percentage / 10)
-					if filled > 10 {
-						filled = 10
-					}
-					empty := 10 - filled
-					bar := strings.Repeat("█", filled) + strings.Repeat("░", empty)
-
-					cachedItem = map[string]interface{}{
-						"name":      "copilot",
-						"full_text": fmt.Sprintf("Copilot: %s %.1f%%", bar, percentage),
-						"color":     "#00FF00",
-					}
-				}
+	switch *qFieldFlag {
+	case "used", "limit", "pct":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid quiet field %q (must be used, limit, or pct)\n", *qFieldFlag)
+		os.Exit(exitError)
+	}
+
+	if *decFlag < 0 || *decFlag > 2 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -decimals %d (must be 0-2)\n", *decFlag)
+		os.Exit(exitError)
+	}
+	countDecimals = *decFlag
+	pctPrecision = min(max(*precFlag, 0), 4)
+
+	if err := validateFields(splitList(*fieldsFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+
+	if !validSortOrder(*sortFlag) {
+		fmt.Fprintf(os.Stderr, "Error: invalid sort order %q (must be count, name, or pct)\n", *sortFlag)
+		os.Exit(exitError)
+	}
+
+	if *groupFlag != "model" && *groupFlag != "family" {
+		fmt.Fprintf(os.Stderr, "Error: invalid -group-by %q (must be model or family)\n", *groupFlag)
+		os.Exit(exitError)
+	}
+
+	if *topFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -top %d (must be 0 or more)\n", *topFlag)
+		os.Exit(exitError)
+	}
+
+	if *pctOfFlag != "limit" && *pctOfFlag != "used" {
+		fmt.Fprintf(os.Stderr, "Error: invalid -pct-of %q (must be limit or used)\n", *pctOfFlag)
+		os.Exit(exitError)
+	}
+
+	if *orgFlag != "" && *userFlag != "" {
+		fmt.Fprintln(os.Stderr, "Error: -org and -user cannot be used together")
+		os.Exit(exitError)
+	}
+
+	if *untilFlag != "" && *sinceFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -until requires -since")
+		os.Exit(exitError)
+	}
+	if *sinceFlag != "" {
+		for _, other := range []struct {
+			name string
+			set  bool
+		}{
+			{"-input", *inputFlag != ""}, {"-compare", *compareFlag}, {"-forecast", *forecastFlag},
+			{"-months", *monthsFlag != 0}, {"-year-summary", *yearSumFlag}, {"-watch", *watchFlag},
+			{"-i3bar", *i3barFlag || *i3onlyFlag || *i3soloFlag}, {"-delta", *deltaFlag}, {"-log", *logFlag},
+			{"-plan-advisor", *advisorFlag}, {"-month", *monthFlag != 0}, {"-year", *yearFlag != 0},
+		} {
+			if other.set {
+				fmt.Fprintf(os.Stderr, "Error: -since cannot be used with %s\n", other.name)
+				os.Exit(exitError)
 			}
-			lastFetch = time.Now()
 		}
+	}
 
-		var items []map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &items); err == nil {
-			newItems := append([]map[string]interface{}{cachedItem}, items...)
-			output, _ := json.Marshal(newItems)
+	if *outputFlag != "" && (*watchFlag || *i3barFlag) {
+		fmt.Fprintln(os.Stderr, "Error: -output cannot be used with -watch or -i3bar")
+		os.Exit(exitError)
+	}
 
-			if first {
-				fmt.Println(string(output))
-				first = false
-			} else {
-				fmt.Println("," + string(output))
+	if *monthsFlag < 0 || *monthsFlag > 24 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -months %d (must be 1-24)\n", *monthsFlag)
+		os.Exit(exitError)
+	}
+
+	if *dryRunFlag {
+		if *inputFlag != "" {
+			fmt.Printf("# -input %s: no requests would be made\n", *inputFlag)
+			os.Exit(exitOK)
+		}
+		var queries []usageQuery
+		switch {
+		case *sinceFlag != "":
+			since, until, err := getRange(*sinceFlag, *untilFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(exitError)
 			}
-			os.Stdout.Sync()
-		} else {
-			if first {
-				fmt.Println(line)
-				first = false
-			} else {
-				fmt.Println("," + line)
+			queries = dayQueries(since, until)
+		case *yearSumFlag:
+			months := 12
+			if now := clock().UTC(); period.Year() == now.Year() {
+				months = int(now.Month())
 			}
-			os.Stdout.Sync()
+			queries = monthQueries(time.Date(period.Year(), time.Month(months), 1, 0, 0, 0, 0, time.UTC), months)
+		case *monthsFlag != 0:
+			queries = monthQueries(period, *monthsFlag)
+		case *compareFlag:
+			queries = monthQueries(period, 2)
+		default:
+			queries = monthQueries(period, 1)
+		}
+		auth := ghAuth{user: ghUser, configDir: cfg.GHConfigDir}
+		acct := Account{Name: *userFlag}
+		if *orgFlag != "" {
+			acct = Account{Name: *orgFlag, Org: true}
+		}
+		for _, cmd := range dryRunCommands(*noGHFlag, getHost(*hostFlag), auth, acct, plan == "", queries) {
+			fmt.Println(cmd)
+		}
+		os.Exit(exitOK)
+	}
+
+	var src UsageSource
+	if *inputFlag != "" {
+		src = &fileSource{path: *inputFlag, host: getHost(*hostFlag)}
+		cacheTTL = 0
+	} else {
+		retry := retryPolicy{attempts: getRetries(*retriesFlag), delay: *delayFlag}
+		auth := ghAuth{user: ghUser, configDir: cfg.GHConfigDir}
+		src, err = newUsageSource(*noGHFlag, getHost(*hostFlag), retry, *timeoutFlag, auth)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+
+	if plan == "" {
+		plan = detectPlan(src, *orgFlag)
+	}
+	limit, err := getLimit(*limitFlag, flagPassed("limit"), plan, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+
+	if *i3barFlag || *i3onlyFlag || *i3soloFlag {
+		opts := i3barOptions{
+			bin:       getI3StatusBin(*i3binFlag),
+			config:    getI3StatusConfig(*i3confFlag),
+			only:      *i3onlyFlag || getI3Standalone(*i3soloFlag),
+			org:       *orgFlag,
+			user:      *userFlag,
+			width:     *barWidthFlag,
+			name:      *i3nameFlag,
+			instance:  *i3instFlag,
+			minWidth:  *i3minFlag,
+			separator: *i3sepFlag,
+			urgent:    *i3urgentFlag,
+			aliases:   cfg.Models.Aliases,
+		}
+		if err := runI3BarMode(src, limit, cacheTTL, opts); err != nil {
+			fmt.Fprintln(os.Stderr, "Error starting i3status:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if *openFlag && *quietFlag {
+		if err := openBrowser(billingURL(src.Host(), Account{Name: *orgFlag, Org: *orgFlag != ""})); err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening browser:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	acct, err := resolveAccount(src, *orgFlag, *userFlag, cacheTTL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
+	}
+
+	ropts := reportOptions{
+		plan:        plan,
+		limit:       limit,
+		period:      period,
+		order:       *sortFlag,
+		price:       *priceFlag,
+		forecast:    *forecastFlag,
+		compare:     *compareFlag,
+		ttl:         cacheTTL,
+		include:     splitList(*modelsFlag),
+		exclude:     splitList(*excludeFlag),
+		pctOf:       *pctOfFlag,
+		minPct:      *minPctFlag,
+		top:         *topFlag,
+		rawModels:   *rawFlag,
+		multipliers: cfg.Multipliers,
+		aliases:     cfg.Models.Aliases,
+	}
+	if *groupFlag == "family" {
+		ropts.families = familyRules(cfg.Families)
+	}
+	vopts := renderOptions{
+		quietField:  *qFieldFlag,
+		bar:         *barFlag,
+		barWidth:    *barWidthFlag,
+		csvMeta:     *csvMetaFlag,
+		jsonCompact: *jsonCFlag,
+		fields:      splitList(*fieldsFlag),
+		noModels:    *noModelsFlag,
+		template:    tmpl,
+		warnColor:   *pbWarnFlag,
+		critColor:   *pbCritFlag,
+	}
+
+	if *sinceFlag != "" {
+		since, until, err := getRange(*sinceFlag, *untilFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitError)
+		}
+		usage, err := fetchRange(src, acct, since, until, cacheTTL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
+			os.Exit(exitError)
+		}
+		period := time.Date(until.Year(), until.Month(), 1, 0, 0, 0, 0, time.UTC)
+		report := buildReport(acct, period, usage, ropts)
+		report.Since, report.Until = since, until
+		applyModelOptions(&report, ropts)
+		if err := writeOutput(*outputFlag, func(w io.Writer) error { return render(w, mode, report, vopts) }); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output:", err)
+			os.Exit(exitError)
+		}
+		os.Exit(thresholdExitCode(report.Percentage, *threshFlag, *exitFlag))
+	}
+
+	if *yearSumFlag {
+		year := period.Year()
+		months := 12
+		if now := clock().UTC(); year == now.Year() {
+			months = int(now.Month())
+		}
+		yopts := ropts
+		yopts.period = time.Date(year, time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+		reports, err := fetchMonths(src, acct, yopts, months)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
+			os.Exit(exitError)
+		}
+		if err := writeOutput(*outputFlag, func(w io.Writer) error { return outputYear(w, year, reports, mode, *jsonCFlag) }); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if *monthsFlag != 0 {
+		reports, err := fetchMonths(src, acct, ropts, *monthsFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
+			os.Exit(exitError)
+		}
+		if err := writeOutput(*outputFlag, func(w io.Writer) error { return outputMonths(w, reports, mode, *jsonCFlag) }); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	var notify *notifier
+	if *notifyFlag {
+		notify = &notifier{threshold: *threshFlag, command: *notifyCmd, host: src.Host()}
+	}
+
+	if *watchFlag {
+		if *intervalFlag <= 0 {
+			fmt.Fprintln(os.Stderr, "Error: -interval must be positive")
+			os.Exit(exitError)
+		}
+		runWatch(src, acct, ropts, mode, vopts, *intervalFlag, notify)
+		return
+	}
+
+	report, err := fetchReport(src, acct, ropts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
+		os.Exit(exitError)
+	}
+
+	if *deltaFlag {
+		line, err := historyDelta(report, clock())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitError)
+		}
+		if err := writeOutput(*outputFlag, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, line)
+			return err
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output:", err)
+			os.Exit(exitError)
 		}
+		return
+	}
+
+	if *advisorFlag {
+		if err := writeOutput(*outputFlag, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, planAdvice(report, clock()))
+			return err
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if *logFlag {
+		if err := logHistory(report, clock()); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: could not log history:", err)
+		}
+	}
+
+	if err := writeOutput(*outputFlag, func(w io.Writer) error { return render(w, mode, report, vopts) }); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing output:", err)
+		os.Exit(exitError)
+	}
+	notify.check(report)
+
+	if *openFlag {
+		if err := openBrowser(billingURL(src.Host(), acct)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening browser:", err)
+			os.Exit(exitError)
+		}
+	}
+
+	gated := report.Percentage
+	if *gateFlag == "projected" {
+		if !report.Forecast {
+			setForecast(&report, clock())
+		}
+		gated = projectedPercentage(report)
+	}
+	os.Exit(thresholdExitCode(gated, *threshFlag, *exitFlag))
+}
+
+func fetchReport(src UsageSource, acct Account, opts reportOptions) (Report, error) {
+	prevPeriod := opts.period.AddDate(0, -1, 0)
+	var prevUsage UsageResponse
+	var prevErr error
+	var wg sync.WaitGroup
+	if opts.compare {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prevUsage, _, prevErr = fetchUsageCached(src, acct, prevPeriod.Year(), int(prevPeriod.Month()), 0, opts.ttl)
+		}()
+	}
+
+	usage, fetched, err := fetchUsageCached(src, acct, opts.period.Year(), int(opts.period.Month()), 0, opts.ttl)
+	wg.Wait()
+	if err != nil {
+		return Report{}, usageError(acct, err)
+	}
+
+	report := buildReport(acct, opts.period, usage, opts)
+	vlog.Printf("%s %s: %d usage items, %.2f used of %d (%.1f%%), %.2f net",
+		acct.Name, opts.period.Format("2006-01"), len(usage.UsageItems), report.Used, report.Limit, report.Percentage, report.Net)
+	applyModelOptions(&report, opts)
+	report.FetchedAt = fetched
+	report.Stale = opts.ttl > 0 && clock().Sub(fetched) > opts.ttl
+	setOverage(&report, opts.price)
+	if opts.forecast {
+		setForecast(&report, clock())
+	}
+
+	if opts.compare {
+		if prevErr != nil {
+			return Report{}, fmt.Errorf("previous month: %w", usageError(acct, prevErr))
+		}
+		previous := buildReport(acct, prevPeriod, prevUsage, opts)
+		applyModelOptions(&previous, opts)
+		setOverage(&previous, opts.price)
+		report.Previous = &previous
+	}
+
+	return report, nil
+}
+
+func render(w io.Writer, mode string, r Report, opts renderOptions) error {
+	switch mode {
+	case "json":
+		return outputJSON(w, r, opts)
+	case "plain":
+		outputPlain(w, r)
+	case "prometheus":
+		outputPrometheus(w, r)
+	case "waybar":
+		return outputWaybar(w, r)
+	case "compact":
+		outputCompact(w, r, opts)
+	case "csv":
+		return outputCSV(w, r, opts.csvMeta)
+	case "yaml":
+		return outputYAML(w, r, opts)
+	case "polybar":
+		outputPolybar(w, r, opts)
+	case "markdown":
+		outputMarkdown(w, r)
+	case "quiet":
+		outputQuiet(w, r, opts.quietField)
+	case "xbar":
+		outputXbar(w, r)
+	case "sketchybar":
+		outputSketchybar(w, r)
+	case "ndjson":
+		return outputNDJSON(w, r)
+	case "bar":
+		fmt.Fprintln(w, drawBar(r.Used, float64(r.Limit), opts.barWidth, boxGlyphs))
+	case "template":
+		return outputTemplate(w, r, opts.template)
+	default:
+		printBox(w, r, opts)
+	}
+	return nil
+}
+
+func thresholdExitCode(percentage, threshold float64, code int) int {
+	if threshold > 0 && percentage >= threshold {
+		return code
 	}
+	return exitOK
 }
 
 func showHelp() {
@@ -195,45 +887,271 @@ Flags:
   -plan string    Copilot plan (free, pro, pro+, business, enterprise)
   -limit int      Custom request limit
   -json           Output JSON
+  -json-compact   Output JSON on a single line
+  -fields string  Comma-separated JSON fields to output, e.g. used,limit,percentage
+  -schema         Print the JSON Schema of the -json output
+  -plain          Output plain key=value lines for scripts
+  -prometheus     Output Prometheus text exposition format
+  -waybar         Output a waybar custom module JSON object
+  -compact        Output a single summary line (add -bar for a usage bar)
+  -bar-only       Print only the usage bar (length set by -bar-width)
+  -bar-full string   Glyph for the used part of usage bars (default █)
+  -bar-empty string  Glyph for the unused part of usage bars (default ░)
+  -bar-included string  Glyph for included usage when the box bar is split
+                  into included and billable parts (default ▒)
+  -bar-width int  Width of the -compact, -bar-only and -i3bar usage bars (default 10)
+  -yaml           Output YAML
+  -polybar        Output a polybar line with color tags (add -bar for a ramp glyph)
+  -polybar-warn-color string  Color at the -warn threshold (default #ffb52a)
+  -polybar-crit-color string  Color at the -crit threshold (default #ff5555)
+  -color-scale string  i3bar/waybar/polybar colors: ramp from green to red,
+                  or threshold to change only at -warn/-crit (default ramp)
+  -xbar           Output an xbar/BitBar plugin menu
+  -sketchybar     Output key=value pairs for sketchybar --set
+  -ndjson         Output one JSON object per line with a timestamp, for
+                  Loki or Elasticsearch (appends a line per refresh with -watch)
+  -template string  Format the report with a Go text/template, e.g.
+                  '{{.Used}}/{{.Limit}} {{bar .Percentage}}'. Fields: .Username,
+                  .Plan, .Used, .Limit, .Percentage, .Models (each with .Model,
+                  .Count, .Percentage). Functions: bar (percentage, optional
+                  width), pct, count and the text/template builtins
+  -csv            Output per-model usage as CSV
+  -markdown       Output a GitHub-flavored markdown table
+  -quiet          Print only the usage percentage
+  -quiet-field string  Value printed by -quiet: used, limit, pct (default pct)
+  -csv-meta       Add # comment lines with user, plan and month to -csv
+  -compare        Compare against the previous month
+  -price float    Dollars per premium request over the limit (default 0.04)
+  -forecast       Project end-of-month usage from the current pace
+  -warn float     Usage percentage shown in yellow (default 75)
+  -crit float     Usage percentage shown in red (default 90)
+  -no-color       Disable colored output (also NO_COLOR)
+  -color string   Box colors: auto, always, never, 16, 256 or truecolor.
+                  auto colors a terminal and reads COLORTERM/TERM for the
+                  color depth; 256 and truecolor use the green-red ramp,
+                  16 colors only yellow and red (default auto)
+  -ascii          Draw the box with ASCII characters only
+                  (automatic when the locale is not UTF-8)
+  -models string  Only show models matching these comma-separated substrings
+  -exclude-models string  Hide models matching these substrings
+  -no-models      Hide the per-model breakdown in the box, JSON and YAML output
+  -raw-models     Show model names exactly as the API returns them
+                  (by default names differing only in case are merged)
+  -decimals int   Decimal places shown for request counts, 0-2 (default 0)
+  -precision int  Decimal places shown for percentages, 0-4 (default 1)
+  -group-by string  List usage per model, or per family (GPT, Claude,
+                  o-series, ...) using "families" prefix rules (default model)
+  -sort string    Per-model sort order: count, name, pct (default count)
+  -min-pct float  Hide models below this percentage from the per-model list;
+                  they still count toward the total (default 0)
+  -top int        Show only the N busiest models, with the rest summed into
+                  an others row (default 0, all models)
+  -pct-of string  Per-model percentage of the limit or of total used (default limit)
+  -threshold float  Exit non-zero when usage percentage reaches this value
+  -exit-code int  Exit code used when -threshold is reached (default 1)
+  -gate string    Compare current or projected end-of-month usage with
+                  -threshold for the exit code (default current)
+  -notify         Send a desktop notification when usage crosses -threshold
+                  (notify-send on Linux, osascript on macOS)
+  -notify-cmd string  Notification command to run instead; the title and
+                  message are appended as arguments
   -i3bar          Output i3bar JSON protocol for status bar
+  -i3bar-only     Emit only the Copilot block, without wrapping i3status
+  -i3-standalone  Same as -i3bar-only
+  -i3status-bin string     i3status binary (default i3status)
+  -i3status-config string  i3status config (default $XDG_CONFIG_HOME/i3status/config)
+  -i3bar-name string       Block name (default copilot)
+  -i3bar-instance string   Block instance (default premium-requests)
+  -i3bar-min-width string  Block min_width, in pixels or as sample text
+  -i3bar-separator         Draw a separator after the block (default true;
+                           -i3bar-separator=false to hide it)
+  -i3bar-urgent            Mark the block urgent at the -crit threshold
+  -cache          Cache gh api results between runs
+  -refresh        Ignore cached results and fetch live, then update the cache
+                  (also -no-cache)
+  -no-gh          Call the GitHub API directly instead of using gh
+  -retries int    Attempts for the usage request (default 3)
+  -retry-delay duration  Initial delay between attempts (default 500ms)
+  -timeout duration  Maximum time to wait for each GitHub request (default 10s)
+  -dry-run        Print the gh api commands (or GET requests with -no-gh)
+                  that would run, without running them
+  -year int       Billing year (default: current year)
+  -month int      Billing month 1-12 (default: current month)
+  -months int     Summarize the last N months up to -month (table, or -json array)
+  -year-summary   Total and per-month usage for -year, up to the current month
+  -since string   Report a date range instead of a month, e.g. 2025-06-01
+                  (fetched day by day, at most 62 days)
+  -until string   Last day of the -since range (default today)
+  -reset-day int  Day of the month usage resets, 1-28 (default 1); moves only
+                  the reset line and countdown, -forecast still uses the
+                  calendar month
+  -reset-tz string  Timezone of the reset, e.g. America/New_York (default UTC)
+  -watch          Redraw the output on an interval until interrupted
+  -interval duration  Refresh interval for -watch (default 1m0s)
+  -host string    GitHub hostname for GitHub Enterprise (default github.com)
+  -org string     Query an organization's usage instead of your own
+  -user string    Query another user's usage (requires billing access)
+  -open           Open the billing settings page in a browser after printing
+                  the summary (with -quiet, only open the page)
+  -output string  Write the output to this file instead of stdout, replacing
+                  it atomically (parent directories are created)
+  -input string   Render a saved usage API response from a file (- for stdin)
+                  instead of calling GitHub
+  -config string  Path to config file
+                  (default $XDG_CONFIG_HOME/copilot-usage/config.json,
+                  %AppData%\copilot-usage\config.json on Windows)
+  -profile string  Use a named profile from the config file
+  -gh-user string  Run gh api as this account from gh auth status
+  -log            Append today's usage to the history log
+                  ($XDG_STATE_HOME/copilot-usage/history.jsonl,
+                  %LocalAppData%\copilot-usage\history.jsonl on Windows)
+  -history        Show recent days from the history log
+  -delta          Print the change in usage since the last history log entry,
+                  e.g. +7 in 2h13m (records each run in the history log)
+  -list-plans     List known plans and their request limits
+  -plan-advisor   Compare each plan's limit with this month's projected usage
+  -verbose        Log gh commands, requests, timings and cache use to stderr
   -version        Show version
+  -check-update   Check GitHub for a newer release
   -help           Show help
 
 Environment:
   GH_COPILOT_PLAN   Default plan
-  GH_COPILOT_LIMIT  Default limit`)
+  GH_COPILOT_LIMIT  Default limit
+  GH_COPILOT_CACHE_TTL  Cache lifetime in seconds (default 300)
+  GH_COPILOT_RETRIES    Default number of attempts
+  GH_COPILOT_I3STATUS_BIN     Default i3status binary
+  GH_COPILOT_I3STATUS_CONFIG  Default i3status config file
+  GH_COPILOT_I3_STANDALONE    Set to 1 to never start i3status in -i3bar mode
+  GH_HOST           Default GitHub hostname
+  GITHUB_TOKEN      Token for the native API path (also GH_TOKEN)
+
+Exit status:
+  0  Usage was fetched and is below -threshold
+  1  Usage reached -threshold (see -exit-code)
+  2  Usage could not be fetched, or the flags or config are invalid`)
 }
 
-func getPlan(cliPlan string) string {
+func getPlan(cliPlan string, cliLimit int, cfg config) (string, error) {
 	if cliPlan != "" {
-		return cliPlan
+		if _, ok := plans[cliPlan]; !ok && cliLimit <= 0 {
+			return "", fmt.Errorf("unknown plan %q (valid plans: %s)", cliPlan, strings.Join(planNames(), ", "))
+		}
+		return cliPlan, nil
 	}
 	if envPlan := os.Getenv("GH_COPILOT_PLAN"); envPlan != "" {
 		if _, ok := plans[envPlan]; ok {
-			return envPlan
+			return envPlan, nil
 		}
 	}
-	return "pro+"
+	if cfg.Plan != "" {
+		return cfg.Plan, nil
+	}
+	return "", nil
+}
+
+func detectPlan(src UsageSource, org string) string {
+	if org == "" {
+		return defaultPlan
+	}
+	name := hostCacheName(src.Host(), "plan-org-"+org)
+	var plan string
+	if readCache(name, planCacheTTL, &plan) && plan != "" {
+		return plan
+	}
+	detected, err := src.Plan(Account{Name: org, Org: true})
+	if err != nil {
+		vlog.Printf("plan detection failed: %v", err)
+		return defaultPlan
+	}
+	if _, ok := plans[detected]; !ok {
+		vlog.Printf("unrecognized plan_type %q", detected)
+		return defaultPlan
+	}
+	writeCache(name, detected)
+	return detected
+}
+
+func listPlans() {
+	fmt.Printf("%-12s %6s\n", "PLAN", "LIMIT")
+	for _, name := range planNames() {
+		fmt.Printf("%-12s %6d\n", name, plans[name])
+	}
+	fmt.Println()
+	fmt.Println("Monthly premium request allowances as published by GitHub for each Copilot plan.")
+	fmt.Println(`Override or add plans under "plans" in the config file.`)
+}
+
+func planNames() []string {
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func getLimit(cliLimit int, plan string) int {
-	if cliLimit > 0 {
-		return cliLimit
+func getLimit(cliLimit int, cliSet bool, plan string, cfg config) (int, error) {
+	if cliSet {
+		if cliLimit <= 0 {
+			return 0, fmt.Errorf("invalid limit %d (must be a positive number of requests)", cliLimit)
+		}
+		vlog.Printf("limit %d from -limit", cliLimit)
+		return cliLimit, nil
 	}
 	if envLimit := os.Getenv("GH_COPILOT_LIMIT"); envLimit != "" {
-		if parsed, err := strconv.Atoi(envLimit); err == nil && parsed > 0 {
-			return parsed
+		parsed, err := strconv.Atoi(envLimit)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid GH_COPILOT_LIMIT %q (must be a positive number of requests)", envLimit)
 		}
+		vlog.Printf("limit %d from GH_COPILOT_LIMIT", parsed)
+		return parsed, nil
+	}
+	if cfg.Limit > 0 {
+		vlog.Printf("limit %d from the config file", cfg.Limit)
+		return cfg.Limit, nil
 	}
 	if limit, ok := plans[plan]; ok {
-		return limit
+		vlog.Printf("limit %d from the %s plan", limit, plan)
+		return limit, nil
+	}
+	vlog.Printf("limit 1500 by default (unknown plan %q)", plan)
+	return 1500, nil
+}
+
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+func validOutputMode(mode string) bool {
+	for _, m := range outputModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func getOutputMode(cfg config, selected map[string]bool) string {
+	for _, m := range outputModes {
+		if selected[m] {
+			return m
+		}
+	}
+	if cfg.Output != "" {
+		return cfg.Output
 	}
-	return 1500
+	return "box"
 }
 
-func getUsername() (string, error) {
-	cmd := exec.Command("gh", "api", "/user", "-q", ".login")
-	out, err := cmd.CombinedOutput()
+func getUsername(runner Runner, host string) (string, error) {
+	out, err := runner.Run("gh", usernameArgs(host)...)
 	if err != nil {
 		msg := strings.TrimSpace(string(out))
 		if msg != "" {
@@ -248,27 +1166,108 @@ func getUsername() (string, error) {
 	return username, nil
 }
 
-func fetchUsage(username string) (UsageResponse, error) {
-	now := time.Now()
-	year := now.Year()
-	month := int(now.Month())
+func getPeriod(year, month int) (time.Time, error) {
+	now := clock().UTC()
+	if year == 0 {
+		year = now.Year()
+	}
+	if month == 0 {
+		month = int(now.Month())
+	}
+	if month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid month %d (must be 1-12)", month)
+	}
+	if year > now.Year() || (year == now.Year() && month > int(now.Month())) {
+		return time.Time{}, fmt.Errorf("%04d-%02d is in the future", year, month)
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+}
 
-	endpoint := fmt.Sprintf("/users/%s/settings/billing/premium_request/usage?year=%d&month=%d", username, year, month)
-	cmd := exec.Command("gh", "api", endpoint)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
+func usageEndpoint(acct Account, year, month, day int) string {
+	owner := "users"
+	if acct.Org {
+		owner = "orgs"
+	}
+	path := fmt.Sprintf("/%s/%s/settings/billing/premium_request/usage?year=%d&month=%d", owner, acct.Name, year, month)
+	if day > 0 {
+		path += fmt.Sprintf("&day=%d", day)
+	}
+	return path
+}
+
+func usageError(acct Account, err error) error {
+	switch {
+	case acct.Org && isNotFound(err):
+		return fmt.Errorf("organization %q not found, or you lack access to its billing (HTTP 404)", acct.Name)
+	case acct.Org && isForbidden(err):
+		return fmt.Errorf("you do not have permission to view billing for organization %q (HTTP 403)", acct.Name)
+	case isForbidden(err):
+		return fmt.Errorf("you do not have permission to view premium request usage for %q (HTTP 403)", acct.Name)
+	}
+	return err
+}
+
+func fetchUsage(runner Runner, host string, acct Account, year, month, day int, retry retryPolicy) (UsageResponse, error) {
+	var out []byte
+	err := retry.run(func() error {
+		var err error
+		out, err = runner.Run("gh", usageArgs(host, acct, year, month, day)...)
 		msg := strings.TrimSpace(string(out))
-		if msg != "" {
-			return UsageResponse{}, fmt.Errorf("%s", msg)
+		if err != nil {
+			if msg != "" {
+				return errors.New(msg)
+			}
+			return err
+		}
+		if msg == "" {
+			return errors.New("empty response")
 		}
+		return nil
+	})
+	if err != nil {
 		return UsageResponse{}, err
 	}
 
+	return decodeUsagePages(out)
+}
+
+// decodeUsagePages decodes one or more concatenated usage responses, as
+// written by gh api --paginate, into a single response.
+func decodeUsagePages(data []byte) (UsageResponse, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
 	var usage UsageResponse
-	if err := json.Unmarshal(out, &usage); err != nil {
+	for {
+		var page json.RawMessage
+		if err := dec.Decode(&page); err == io.EOF {
+			break
+		} else if err != nil {
+			return UsageResponse{}, err
+		}
+		p, err := decodeUsage(page)
+		if err != nil {
+			return UsageResponse{}, err
+		}
+		if usage.User == "" {
+			usage.User = p.User
+		}
+		usage.UsageItems = append(usage.UsageItems, p.UsageItems...)
+	}
+	return usage, nil
+}
+
+func decodeUsage(data []byte) (UsageResponse, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
 		return UsageResponse{}, err
 	}
+	if _, ok := fields["usageItems"]; !ok {
+		fmt.Fprintln(os.Stderr, "Warning: usage response has no usageItems field; the API format may have changed")
+	}
 
+	var usage UsageResponse
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return UsageResponse{}, err
+	}
 	return usage, nil
 }
 
@@ -280,101 +1279,1028 @@ func calculateTotalUsage(items []UsageItem) float64 {
 	return total
 }
 
-func outputJSON(username, plan string, limit int, used, percentage float64, items []UsageItem) {
-	modelCounts := make(map[string]float64)
-	for _, item := range items {
-		modelCounts[item.Model] += item.GrossQuantity
+func calculateWeightedUsage(items []UsageItem, multipliers map[string]float64) float64 {
+	weights := make(map[string]float64, len(multipliers))
+	for model, m := range multipliers {
+		weights[strings.ToLower(model)] = m
 	}
+	total := 0.0
+	for _, item := range items {
+		m, ok := weights[strings.ToLower(strings.TrimSpace(item.Model))]
+		if !ok {
+			m = 1
+		}
+		total += item.GrossQuantity * m
+	}
+	return total
+}
 
-	now := time.Now()
-	result := map[string]interface{}{
-		"username":   username,
-		"plan":       plan,
-		"limit":      limit,
-		"used":       used,
-		"percentage": fmt.Sprintf("%.1f", percentage),
-		"month":      now.Format("January 2006"),
-		"models":     modelCounts,
+func calculateNetUsage(items []UsageItem) (quantity, amount float64) {
+	for _, item := range items {
+		quantity += item.NetQuantity
+		amount += item.NetAmount
 	}
+	return quantity, amount
+}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(result)
+func buildReport(acct Account, period time.Time, usage UsageResponse, opts reportOptions) Report {
+	used := calculateTotalUsage(usage.UsageItems)
+	net, netAmount := calculateNetUsage(usage.UsageItems)
+	weighted := used
+	if len(opts.multipliers) > 0 {
+		weighted = calculateWeightedUsage(usage.UsageItems, opts.multipliers)
+	}
+	modelCounts := aggregateModels(usage.UsageItems, opts.rawModels, opts.aliases)
+	if opts.families != nil {
+		modelCounts = groupByFamily(modelCounts, opts.families)
+	}
+	return Report{
+		Weighted:   len(opts.multipliers) > 0,
+		Billed:     weighted,
+		Username:   acct.Name,
+		Org:        acct.Org,
+		Plan:       opts.plan,
+		Limit:      opts.limit,
+		Used:       used,
+		Net:        net,
+		NetAmount:  netAmount,
+		Percentage: percentOf(used, opts.limit),
+		Period:     period,
+		ResetAt:    cycle.resetFor(period, clock()),
+		Models:     sortedModels(modelCounts, opts.limit, opts.order),
+		ByFamily:   opts.families != nil,
+	}
 }
 
-func printBox(username, plan string, limit int, used, percentage float64, items []UsageItem) {
-	now := time.Now()
-	monthName := now.Format("January 2006")
-	title := fmt.Sprintf("GitHub Copilot %s - Premium Requests", capitalize(plan))
+func formatCountdown(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	if days == 0 {
+		return fmt.Sprintf("%dh %dm", hours, int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd %dh", days, hours)
+}
 
-	width := 58
-	innerWidth := width - 2
+func percentOf(n float64, limit int) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return n / float64(limit) * 100
+}
+
+func setOverage(r *Report, price float64) {
+	r.Price = price
+	r.Overage = 0
+	if r.Used > float64(r.Limit) {
+		r.Overage = r.Used - float64(r.Limit)
+	}
+	r.OverageCost = math.Round(r.Overage*price*100) / 100
+}
 
-	fmt.Println("┌" + strings.Repeat("─", width) + "┐")
-	fmt.Println("│" + center("", innerWidth) + "│")
-	fmt.Println("│" + center(title, innerWidth) + "│")
-	fmt.Println("│" + center(monthName+" • "+username, innerWidth) + "│")
-	fmt.Println("│" + center("", innerWidth) + "│")
-	fmt.Println("├" + strings.Repeat("─", width) + "├")
+func overageLine(r Report) string {
+	return fmt.Sprintf("Overage: %s requests %s $%.2f = $%.2f", formatCount(r.Overage), boxGlyphs.times, r.Price, r.OverageCost)
+}
+
+func setForecast(r *Report, now time.Time) {
+	r.Forecast = true
+	r.Projected = r.Used
+
+	utc := now.UTC()
+	if utc.Year() != r.Period.Year() || utc.Month() != r.Period.Month() {
+		return
+	}
+	// Usage is fetched per calendar month, so the forecast spreads it over
+	// the calendar month too, whatever -reset-day says.
+	elapsed := utc.Day()
+	total := time.Date(utc.Year(), utc.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	r.Projected = r.Used / float64(elapsed) * float64(total)
+}
 
-	usageStr := fmt.Sprintf("Overall:  %d/%d (%.1f%%)", int(used), limit, percentage)
-	fmt.Println("│ " + padRight(usageStr, innerWidth-1) + "│")
+func projectedPercentage(r Report) float64 {
+	return percentOf(r.Projected, r.Limit)
+}
 
-	bar := drawBar(used, float64(limit), innerWidth-9)
-	fmt.Println("│ Usage:  " + bar + "│")
-	fmt.Println("│" + center("", innerWidth) + "│")
+func forecastLine(r Report) string {
+	line := fmt.Sprintf("Forecast: %s/%d (%s%%)", formatCount(r.Projected), r.Limit, formatPct(projectedPercentage(r)))
+	if r.Projected > float64(r.Limit) {
+		line += " - over limit"
+	}
+	return line
+}
 
-	nextMonth := now.AddDate(0, 1, 0)
-	resetStr := fmt.Sprintf("Resets: %s 1, %d at 00:00 UTC", nextMonth.Format("January"), nextMonth.Year())
-	fmt.Println("│ " + padRight(resetStr, innerWidth-1) + "│")
-	fmt.Println("├" + strings.Repeat("─", width) + "├")
-	fmt.Println("│ " + padRight("Per-model usage:", innerWidth-1) + "│")
-	fmt.Println("│" + center("", innerWidth) + "│")
+func comparison(r Report) string {
+	delta := roundCount(r.Used) - roundCount(r.Previous.Used)
+	return fmt.Sprintf("vs last month: %+.*f (%+.*fpp)", countDecimals, delta, pctPrecision, r.Percentage-r.Previous.Percentage)
+}
 
+func aggregateModels(items []UsageItem, raw bool, aliases map[string]string) map[string]float64 {
+	labels := make(map[string]string, len(aliases))
+	for model, alias := range aliases {
+		labels[strings.ToLower(strings.TrimSpace(model))] = alias
+	}
 	modelCounts := make(map[string]float64)
+	names := make(map[string]string)
 	for _, item := range items {
-		modelCounts[item.Model] += item.GrossQuantity
+		name := item.Model
+		if alias, ok := labels[strings.ToLower(strings.TrimSpace(name))]; ok {
+			name = alias
+		}
+		if !raw {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if first, ok := names[key]; ok {
+				name = first
+			} else {
+				name = strings.TrimSpace(name)
+				names[key] = name
+			}
+		}
+		modelCounts[name] += item.GrossQuantity
+	}
+	return modelCounts
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+func matchesAny(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterModels(models []ModelUsage, include, exclude []string) []ModelUsage {
+	if len(include) == 0 && len(exclude) == 0 {
+		return models
+	}
+	filtered := make([]ModelUsage, 0, len(models))
+	for _, m := range models {
+		if len(include) > 0 && !matchesAny(m.Model, include) {
+			continue
+		}
+		if matchesAny(m.Model, exclude) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered
+}
+
+func applyModelOptions(r *Report, opts reportOptions) {
+	r.Models = filterModels(r.Models, opts.include, opts.exclude)
+	if opts.pctOf == "used" {
+		shareOfUsed(r.Models, r.Used)
+	}
+	hideSmallModels(r, opts.minPct)
+	keepTopModels(r, opts.top)
+}
+
+func hideModel(r *Report, m ModelUsage) {
+	if m.Count > 0 {
+		r.Hidden++
+		r.HiddenUsed += m.Count
+		r.HiddenPct += m.Percentage
+	}
+}
+
+func hideSmallModels(r *Report, minPct float64) {
+	if minPct <= 0 {
+		return
+	}
+	kept := make([]ModelUsage, 0, len(r.Models))
+	for _, m := range r.Models {
+		if m.Percentage >= minPct {
+			kept = append(kept, m)
+			continue
+		}
+		hideModel(r, m)
+	}
+	r.Models = kept
+}
+
+// keepTopModels keeps the n models with the highest counts, in their
+// current sort order, and folds the rest into the others row.
+func keepTopModels(r *Report, n int) {
+	if n <= 0 || len(r.Models) <= n {
+		return
+	}
+	busiest := make([]ModelUsage, len(r.Models))
+	copy(busiest, r.Models)
+	sort.SliceStable(busiest, func(i, j int) bool {
+		if busiest[i].Count != busiest[j].Count {
+			return busiest[i].Count > busiest[j].Count
+		}
+		return busiest[i].Model < busiest[j].Model
+	})
+	top := make(map[string]bool, n)
+	for _, m := range busiest[:n] {
+		top[m.Model] = true
+	}
+	kept := make([]ModelUsage, 0, n)
+	for _, m := range r.Models {
+		if top[m.Model] {
+			kept = append(kept, m)
+			continue
+		}
+		hideModel(r, m)
+	}
+	r.Models = kept
+}
+
+func validSortOrder(order string) bool {
+	switch order {
+	case "count", "name", "pct":
+		return true
 	}
+	return false
+}
+
+func sortedModels(modelCounts map[string]float64, limit int, order string) []ModelUsage {
+	models := make([]ModelUsage, 0, len(modelCounts))
+	for model, count := range modelCounts {
+		models = append(models, ModelUsage{
+			Model:      model,
+			Count:      count,
+			Percentage: percentOf(count, limit),
+		})
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		a, b := models[i], models[j]
+		switch order {
+		case "name":
+			return a.Model < b.Model
+		case "pct":
+			if a.Percentage != b.Percentage {
+				return a.Percentage > b.Percentage
+			}
+		default:
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+		}
+		return a.Model < b.Model
+	})
+	return models
+}
 
-	if len(modelCounts) == 0 {
-		fmt.Println("│ " + padRight("No premium requests used yet.", innerWidth-1) + "│")
+func shareOfUsed(models []ModelUsage, used float64) {
+	for i := range models {
+		models[i].Percentage = 0
+		if used > 0 {
+			models[i].Percentage = models[i].Count / used * 100
+		}
+	}
+}
+
+type JSONReport struct {
+	Username            string       `json:"username,omitempty" yaml:"username,omitempty"`
+	Org                 string       `json:"org,omitempty" yaml:"org,omitempty"`
+	Plan                string       `json:"plan" yaml:"plan"`
+	Limit               int          `json:"limit" yaml:"limit"`
+	Used                float64      `json:"used" yaml:"used"`
+	Net                 float64      `json:"net" yaml:"net"`
+	NetAmount           float64      `json:"net_amount" yaml:"net_amount"`
+	Percentage          float64      `json:"percentage" yaml:"percentage"`
+	Month               string       `json:"month" yaml:"month"`
+	Since               string       `json:"since,omitempty" yaml:"since,omitempty"`
+	Until               string       `json:"until,omitempty" yaml:"until,omitempty"`
+	ResetAt             string       `json:"reset_at" yaml:"reset_at"`
+	SecondsUntilReset   int64        `json:"seconds_until_reset" yaml:"seconds_until_reset"`
+	Models              []ModelUsage `json:"models" yaml:"models"`
+	Others              *OtherModels `json:"others,omitempty" yaml:"others,omitempty"`
+	OverageCost         float64      `json:"overage_cost" yaml:"overage_cost"`
+	BilledUsed          *float64     `json:"billed_used,omitempty" yaml:"billed_used,omitempty"`
+	LastFetch           string       `json:"last_fetch,omitempty" yaml:"last_fetch,omitempty"`
+	Stale               *bool        `json:"stale,omitempty" yaml:"stale,omitempty"`
+	ProjectedUsed       *float64     `json:"projected_used,omitempty" yaml:"projected_used,omitempty"`
+	ProjectedPercentage *float64     `json:"projected_percentage,omitempty" yaml:"projected_percentage,omitempty"`
+	ProjectedOverLimit  *bool        `json:"projected_over_limit,omitempty" yaml:"projected_over_limit,omitempty"`
+	Previous            *JSONReport  `json:"previous,omitempty" yaml:"previous,omitempty"`
+}
+
+// OtherModels totals the models left out of the list by -top or -min-pct.
+type OtherModels struct {
+	Models     int     `json:"models" yaml:"models"`
+	Count      float64 `json:"count" yaml:"count"`
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+}
+
+func jsonReport(r Report) JSONReport {
+	result := JSONReport{
+		Plan:        r.Plan,
+		Limit:       r.Limit,
+		Used:        math.Round(r.Used*100) / 100,
+		Net:         math.Round(r.Net*100) / 100,
+		NetAmount:   math.Round(r.NetAmount*100) / 100,
+		Percentage:  roundPct(r.Percentage),
+		Month:       periodLabel(r),
+		ResetAt:     r.ResetAt.Format(time.RFC3339),
+		Models:      roundedModels(r.Models),
+		OverageCost: r.OverageCost,
+	}
+	if r.Weighted {
+		billed := math.Round(r.Billed*100) / 100
+		result.BilledUsed = &billed
+	}
+	if r.Hidden > 0 {
+		result.Others = &OtherModels{
+			Models:     r.Hidden,
+			Count:      math.Round(r.HiddenUsed*100) / 100,
+			Percentage: roundPct(r.HiddenPct),
+		}
+	}
+	if !r.Since.IsZero() {
+		result.Since = r.Since.Format("2006-01-02")
+		result.Until = r.Until.Format("2006-01-02")
+	}
+	if until := r.ResetAt.Sub(clock()); until > 0 {
+		result.SecondsUntilReset = int64(until.Seconds())
+	}
+	if !r.FetchedAt.IsZero() {
+		stale := r.Stale
+		result.LastFetch = r.FetchedAt.UTC().Format(time.RFC3339)
+		result.Stale = &stale
+	}
+	if r.Org {
+		result.Org = r.Username
 	} else {
-		for model, count := range modelCounts {
-			if count == 0 {
-				continue
+		result.Username = r.Username
+	}
+	if r.Forecast {
+		used := math.Round(r.Projected*100) / 100
+		pct := roundPct(projectedPercentage(r))
+		over := r.Projected > float64(r.Limit)
+		result.ProjectedUsed = &used
+		result.ProjectedPercentage = &pct
+		result.ProjectedOverLimit = &over
+	}
+	if r.Previous != nil {
+		previous := jsonReport(*r.Previous)
+		result.Previous = &previous
+	}
+	return result
+}
+
+func roundPct(pct float64) float64 {
+	p := math.Pow10(pctPrecision)
+	return math.Round(pct*p) / p
+}
+
+func formatPct(pct float64) string {
+	return strconv.FormatFloat(roundPct(pct), 'f', pctPrecision, 64)
+}
+
+func roundedModels(models []ModelUsage) []ModelUsage {
+	rounded := make([]ModelUsage, len(models))
+	for i, m := range models {
+		m.Count = math.Round(m.Count*100) / 100
+		m.Percentage = roundPct(m.Percentage)
+		rounded[i] = m
+	}
+	return rounded
+}
+
+func outputJSON(w io.Writer, r Report, opts renderOptions) error {
+	result := jsonReport(r)
+	if opts.noModels {
+		fields := opts.fields
+		if len(fields) == 0 {
+			fields = jsonFieldNames()
+		}
+		opts.fields = slices.DeleteFunc(slices.Clone(fields), func(f string) bool { return f == "models" })
+	}
+	if len(opts.fields) > 0 {
+		return outputJSONFields(w, result, opts)
+	}
+
+	enc := json.NewEncoder(w)
+	if !opts.jsonCompact {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(result)
+}
+
+func jsonFieldNames() []string {
+	t := reflect.TypeOf(JSONReport{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+func validateFields(fields []string) error {
+	valid := jsonFieldNames()
+	for _, f := range fields {
+		if !slices.Contains(valid, f) {
+			return fmt.Errorf("unknown field %q (valid fields: %s)", f, strings.Join(valid, ", "))
+		}
+	}
+	return nil
+}
+
+func outputJSONFields(w io.Writer, result JSONReport, opts renderOptions) error {
+	data, _ := json.Marshal(result)
+	var all map[string]json.RawMessage
+	json.Unmarshal(data, &all)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for _, name := range jsonFieldNames() {
+		value, ok := all[name]
+		if !ok || !slices.Contains(opts.fields, name) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	if !opts.jsonCompact {
+		var indented bytes.Buffer
+		json.Indent(&indented, buf.Bytes(), "", "  ")
+		buf = indented
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type ndjsonRecord struct {
+	TS         string             `json:"ts"`
+	Username   string             `json:"username"`
+	Org        bool               `json:"org"`
+	Plan       string             `json:"plan"`
+	Month      string             `json:"month"`
+	Used       float64            `json:"used"`
+	Limit      int                `json:"limit"`
+	Percentage float64            `json:"percentage"`
+	Models     map[string]float64 `json:"models"`
+}
+
+func outputNDJSON(w io.Writer, r Report) error {
+	record := ndjsonRecord{
+		TS:         clock().UTC().Format(time.RFC3339),
+		Username:   r.Username,
+		Org:        r.Org,
+		Plan:       r.Plan,
+		Month:      r.Period.Format("2006-01"),
+		Used:       math.Round(r.Used*100) / 100,
+		Limit:      r.Limit,
+		Percentage: roundPct(r.Percentage),
+		Models:     make(map[string]float64, len(r.Models)),
+	}
+	for _, m := range r.Models {
+		record.Models[m.Model] = math.Round(m.Count*100) / 100
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(record)
+}
+
+func outputYAML(w io.Writer, r Report, opts renderOptions) error {
+	var doc yaml.Node
+	if err := doc.Encode(jsonReport(r)); err != nil {
+		return err
+	}
+	if opts.noModels {
+		for i := 0; i < len(doc.Content); i += 2 {
+			if doc.Content[i].Value == "models" {
+				doc.Content = slices.Delete(doc.Content, i, i+2)
+				break
 			}
-			modelPct := (count / float64(limit)) * 100
-			line := fmt.Sprintf("%-22s %5d %6.1f%%", model, int(count), modelPct)
-			fmt.Println("│ " + padRight(line, innerWidth-1) + "│")
 		}
 	}
 
-	fmt.Println("│" + center("", innerWidth) + "│")
-	fmt.Println("└" + strings.Repeat("─", width) + "┘")
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func outputPlain(w io.Writer, r Report) {
+	if r.Org {
+		fmt.Fprintf(w, "org=%s\n", plainValue(r.Username))
+	} else {
+		fmt.Fprintf(w, "username=%s\n", plainValue(r.Username))
+	}
+	fmt.Fprintf(w, "plan=%s\n", plainValue(r.Plan))
+	fmt.Fprintf(w, "month=%s\n", r.Period.Format("2006-01"))
+	fmt.Fprintf(w, "used=%s\n", formatQuantity(r.Used))
+	fmt.Fprintf(w, "net=%s\n", formatQuantity(r.Net))
+	fmt.Fprintf(w, "net_amount=%.2f\n", r.NetAmount)
+	fmt.Fprintf(w, "limit=%d\n", r.Limit)
+	fmt.Fprintf(w, "percentage=%s\n", formatPct(r.Percentage))
+	fmt.Fprintf(w, "overage=%s\n", formatQuantity(r.Overage))
+	fmt.Fprintf(w, "overage_cost=%.2f\n", r.OverageCost)
+	if r.Forecast {
+		fmt.Fprintf(w, "projected_used=%s\n", formatQuantity(r.Projected))
+		fmt.Fprintf(w, "projected_percentage=%s\n", formatPct(projectedPercentage(r)))
+	}
+	if r.Previous != nil {
+		fmt.Fprintf(w, "previous_used=%s\n", formatQuantity(r.Previous.Used))
+		fmt.Fprintf(w, "previous_percentage=%s\n", formatPct(r.Previous.Percentage))
+	}
+
+	for _, m := range r.Models {
+		fmt.Fprintf(w, "model=%s count=%s\n", plainValue(m.Model), formatQuantity(m.Count))
+	}
 }
 
-func drawBar(used, total float64, width int) string {
-	filled := int((used / total) * float64(width))
+func plainValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t=\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func roundCount(f float64) float64 {
+	p := math.Pow10(countDecimals)
+	return math.Round(f*p) / p
+}
+
+func formatCount(f float64) string {
+	return strconv.FormatFloat(roundCount(f), 'f', countDecimals, 64)
+}
+
+func formatQuantity(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+func outputPrometheus(w io.Writer, r Report) {
+	owner := "user"
+	if r.Org {
+		owner = "org"
+	}
+	labels := fmt.Sprintf(`plan="%s",%s="%s"`, promLabel(r.Plan), owner, promLabel(r.Username))
+
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"copilot_premium_requests_used", "Premium requests used in the billing period.", r.Used},
+		{"copilot_premium_requests_limit", "Premium requests included in the plan.", float64(r.Limit)},
+		{"copilot_premium_requests_percentage", "Percentage of the premium request limit used.", r.Percentage},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+		fmt.Fprintf(w, "%s{%s} %s\n", g.name, labels, formatQuantity(g.value))
+	}
+
+	fmt.Fprintln(w, "# HELP copilot_premium_requests_by_model Premium requests used per model.")
+	fmt.Fprintln(w, "# TYPE copilot_premium_requests_by_model gauge")
+	for _, m := range r.Models {
+		fmt.Fprintf(w, "copilot_premium_requests_by_model{%s,model=\"%s\"} %s\n", labels, promLabel(m.Model), formatQuantity(m.Count))
+	}
+}
+
+func promLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func outputWaybar(w io.Writer, r Report) error {
+	class := "normal"
+	switch {
+	case r.Percentage >= critThreshold:
+		class = "critical"
+	case r.Percentage >= warnThreshold:
+		class = "warning"
+	}
+
+	tooltip := []string{
+		fmt.Sprintf("GitHub Copilot %s - %s", capitalize(r.Plan), periodLabel(r)),
+		fmt.Sprintf("%s: %s/%d (%s%%)", r.Username, formatCount(r.Used), r.Limit, formatPct(r.Percentage)),
+	}
+	if len(r.Models) > 0 {
+		tooltip = append(tooltip, "")
+	}
+	for _, m := range r.Models {
+		if m.Count == 0 {
+			continue
+		}
+		tooltip = append(tooltip, fmt.Sprintf("%s: %s (%s%%)", m.Model, formatCount(m.Count), formatPct(m.Percentage)))
+	}
+
+	text := fmt.Sprintf("Copilot: %s%%", formatPct(r.Percentage))
+	if colorRamp {
+		text = fmt.Sprintf("<span color='%s'>%s</span>", rampColor(r.Percentage), text)
+	}
+
+	result := map[string]interface{}{
+		"text":       text,
+		"tooltip":    strings.Join(tooltip, "\n"),
+		"percentage": int(r.Percentage),
+		"class":      class,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(result)
+}
+
+func outputCompact(w io.Writer, r Report, opts renderOptions) {
+	line := "Copilot "
+	if opts.bar {
+		line += drawBar(r.Used, float64(r.Limit), opts.barWidth, boxGlyphs) + " "
+	}
+	fmt.Fprintf(w, "%s%s/%d (%s%%)\n", line, formatCount(r.Used), r.Limit, formatPct(r.Percentage))
+}
+
+func outputPolybar(w io.Writer, r Report, opts renderOptions) {
+	text := fmt.Sprintf("Copilot %s%%", formatPct(r.Percentage))
+	if opts.bar {
+		text = rampGlyph(r.Percentage) + " " + text
+	}
+
+	if color := statusColor(r.Percentage, "", opts.warnColor, opts.critColor); color != "" {
+		text = "%{F" + color + "}" + text + "%{F-}"
+	}
+	fmt.Fprintln(w, text)
+}
+
+func outputXbar(w io.Writer, r Report) {
+	title := fmt.Sprintf("Copilot %s%%", formatPct(r.Percentage))
+	switch {
+	case r.Percentage >= critThreshold:
+		title += " | color=#ff5555"
+	case r.Percentage >= warnThreshold:
+		title += " | color=#ffb52a"
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w, "---")
+	fmt.Fprintf(w, "%s · %s · %s\n", r.Username, capitalize(r.Plan), periodLabel(r))
+	fmt.Fprintf(w, "%s/%d requests (%s%%)\n", formatCount(r.Used), r.Limit, formatPct(r.Percentage))
+	if len(r.Models) > 0 {
+		fmt.Fprintln(w, "---")
+	}
+	for _, m := range r.Models {
+		if m.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s (%s%%)\n", strings.ReplaceAll(m.Model, "|", "/"), formatCount(m.Count), formatPct(m.Percentage))
+	}
+}
+
+func outputSketchybar(w io.Writer, r Report) {
+	fmt.Fprintf(w, "label=Copilot %s%%\n", formatPct(r.Percentage))
+	switch {
+	case r.Percentage >= critThreshold:
+		fmt.Fprintln(w, "label.color=0xffff5555")
+	case r.Percentage >= warnThreshold:
+		fmt.Fprintln(w, "label.color=0xffffb52a")
+	}
+}
+
+func rampGlyph(pct float64) string {
+	ramp := []rune("▁▂▃▄▅▆▇█")
+	i := int(pct / 100 * float64(len(ramp)))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(ramp) {
+		i = len(ramp) - 1
+	}
+	return string(ramp[i])
+}
+
+func outputQuiet(w io.Writer, r Report, field string) {
+	switch field {
+	case "used":
+		fmt.Fprintln(w, formatQuantity(r.Used))
+	case "limit":
+		fmt.Fprintln(w, r.Limit)
+	default:
+		fmt.Fprintln(w, formatPct(r.Percentage))
+	}
+}
+
+func outputMarkdown(w io.Writer, r Report) {
+	fmt.Fprintf(w, "**%s · %s · %s: %s/%d requests (%s%%)**\n\n",
+		markdownEscape(r.Username), capitalize(r.Plan), periodLabel(r), formatCount(r.Used), r.Limit, formatPct(r.Percentage))
+
+	if r.Used == 0 {
+		fmt.Fprintln(w, noUsageMessage(r, clock()))
+		return
+	}
+
+	fmt.Fprintln(w, "| Model | Requests | % |")
+	fmt.Fprintln(w, "|---|--:|--:|")
+	for _, m := range r.Models {
+		if m.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "| %s | %s | %s%% |\n", markdownEscape(m.Model), formatCount(m.Count), formatPct(m.Percentage))
+	}
+	if r.Hidden > 0 {
+		fmt.Fprintf(w, "| %s | %s | %s%% |\n", othersLabel(r.Hidden), formatCount(r.HiddenUsed), formatPct(r.HiddenPct))
+	}
+}
+
+func othersLabel(n int) string {
+	if n == 1 {
+		return "1 other"
+	}
+	return fmt.Sprintf("%d others", n)
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func outputCSV(w io.Writer, r Report, meta bool) error {
+	if meta {
+		owner := "username"
+		if r.Org {
+			owner = "org"
+		}
+		fmt.Fprintf(w, "# %s: %s\n", owner, r.Username)
+		fmt.Fprintf(w, "# plan: %s\n", r.Plan)
+		fmt.Fprintf(w, "# month: %s\n", r.Period.Format("2006-01"))
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"model", "count", "percentage"})
+	for _, m := range r.Models {
+		cw.Write([]string{m.Model, formatQuantity(m.Count), formatPct(m.Percentage)})
+	}
+	if r.Hidden > 0 {
+		cw.Write([]string{"OTHERS", formatQuantity(r.HiddenUsed), formatPct(r.HiddenPct)})
+	}
+	cw.Write([]string{"TOTAL", formatQuantity(r.Used), formatPct(r.Percentage)})
+	cw.Flush()
+	return cw.Error()
+}
+
+func printBox(w io.Writer, r Report, opts renderOptions) {
+	g := boxGlyphs
+	now := clock()
+	monthName := periodLabel(r)
+	title := fmt.Sprintf("GitHub Copilot %s - Premium Requests", capitalize(r.Plan))
+
+	width := boxWidth(w)
+	innerWidth := width - 2
+
+	fmt.Fprintln(w, g.topLeft+strings.Repeat(g.horiz, innerWidth)+g.topRight)
+	fmt.Fprintln(w, g.vert+center("", innerWidth)+g.vert)
+	fmt.Fprintln(w, g.vert+center(title, innerWidth)+g.vert)
+	subtitle := monthName + " " + g.bullet + " " + r.Username
+	if r.Stale {
+		subtitle += fmt.Sprintf(" (stale, fetched %s ago)", formatAge(clock().Sub(r.FetchedAt)))
+	}
+	fmt.Fprintln(w, g.vert+center(subtitle, innerWidth)+g.vert)
+	fmt.Fprintln(w, g.vert+center("", innerWidth)+g.vert)
+	fmt.Fprintln(w, g.teeLeft+strings.Repeat(g.horiz, innerWidth)+g.teeRight)
+
+	usageStr := fmt.Sprintf("Overall:  %s/%d (%s%%)", formatCount(r.Used), r.Limit, formatPct(r.Percentage))
+	if r.Weighted {
+		usageStr = fmt.Sprintf("Overall:  %s raw / %s billed of %d (%s%%)", formatCount(r.Used), formatCount(r.Billed), r.Limit, formatPct(r.Percentage))
+	}
+	fmt.Fprintln(w, g.vert+" "+colorize(padRight(usageStr, innerWidth-1), r.Percentage)+g.vert)
+	netStr := fmt.Sprintf("Billed:   %s net of %s gross ($%.2f)", formatCount(r.Net), formatCount(r.Used), r.NetAmount)
+	fmt.Fprintln(w, g.vert+" "+padRight(netStr, innerWidth-1)+g.vert)
+	if r.Previous != nil {
+		fmt.Fprintln(w, g.vert+" "+padRight(comparison(r), innerWidth-1)+g.vert)
+	}
+	if r.Overage > 0 {
+		fmt.Fprintln(w, g.vert+" "+colorize(padRight(overageLine(r), innerWidth-1), r.Percentage)+g.vert)
+	}
+	if r.Forecast {
+		fmt.Fprintln(w, g.vert+" "+colorize(padRight(forecastLine(r), innerWidth-1), projectedPercentage(r))+g.vert)
+	}
+
+	bar := drawBar(r.Used, float64(r.Limit), innerWidth-9, g)
+	if r.Net > 0 {
+		bar = drawSplitBar(r.Used-r.Net, r.Net, float64(r.Limit), innerWidth-9, g)
+	}
+	fmt.Fprintln(w, g.vert+" Usage:  "+colorize(bar, r.Percentage)+g.vert)
+	fmt.Fprintln(w, g.vert+center("", innerWidth)+g.vert)
+
+	resetStr := "Resets: " + r.ResetAt.Format("January 2, 2006 at 15:04 MST")
+	fmt.Fprintln(w, g.vert+" "+padRight(resetStr, innerWidth-1)+g.vert)
+	if until := r.ResetAt.Sub(now); until > 0 {
+		fmt.Fprintln(w, g.vert+" "+padRight("Time left: "+formatCountdown(until), innerWidth-1)+g.vert)
+	}
+	if !opts.noModels {
+		heading := "Per-model usage:"
+		if r.ByFamily {
+			heading = "Per-family usage:"
+		}
+		fmt.Fprintln(w, g.teeLeft+strings.Repeat(g.horiz, innerWidth)+g.teeRight)
+		fmt.Fprintln(w, g.vert+" "+padRight(heading, innerWidth-1)+g.vert)
+		fmt.Fprintln(w, g.vert+center("", innerWidth)+g.vert)
+
+		if r.Used == 0 {
+			fmt.Fprintln(w, g.vert+" "+padRight(noUsageMessage(r, now), innerWidth-1)+g.vert)
+		} else if len(r.Models) == 0 && r.Hidden == 0 {
+			fmt.Fprintln(w, g.vert+" "+padRight("No matching models.", innerWidth-1)+g.vert)
+		} else {
+			for _, line := range modelRows(r.Models, innerWidth-1, g) {
+				fmt.Fprintln(w, g.vert+" "+padRight(line, innerWidth-1)+g.vert)
+			}
+			if r.Hidden > 0 {
+				others := fmt.Sprintf("%sand %s (%s)", g.ellipsis, othersLabel(r.Hidden), formatCount(r.HiddenUsed))
+				fmt.Fprintln(w, g.vert+" "+padRight(others, innerWidth-1)+g.vert)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, g.vert+center("", innerWidth)+g.vert)
+	fmt.Fprintln(w, g.bottomLeft+strings.Repeat(g.horiz, innerWidth)+g.bottomRight)
+}
+
+func periodLabel(r Report) string {
+	if !r.Since.IsZero() {
+		return rangeLabel(r.Since, r.Until)
+	}
+	return r.Period.Format("January 2006")
+}
+
+// modelRows lays out the per-model lines in columns sized to the data, so
+// long names never run into the counts. Names are only ellipsized when the
+// row would not fit in width; the share bar is dropped first.
+func modelRows(models []ModelUsage, width int, g glyphs) []string {
+	var nameW, countW, pctW int
+	for _, m := range models {
+		if m.Count == 0 {
+			continue
+		}
+		nameW = max(nameW, displayWidth(m.Model))
+		countW = max(countW, len(formatCount(m.Count)))
+		pctW = max(pctW, len(formatPct(m.Percentage))+1)
+	}
+	numbersW := 2 + countW + 2 + pctW
+	withBar := nameW+numbersW+2+modelBarWidth <= width
+	if !withBar {
+		nameW = min(nameW, max(width-numbersW, 1))
+	}
+
+	var rows []string
+	for _, m := range models {
+		if m.Count == 0 {
+			continue
+		}
+		row := fmt.Sprintf("%s  %*s  %*s", ellipsize(m.Model, nameW), countW, formatCount(m.Count), pctW, formatPct(m.Percentage)+"%")
+		if withBar {
+			row += "  " + drawBar(m.Percentage, 100, modelBarWidth, g)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func noUsageMessage(r Report, now time.Time) string {
+	if !r.Since.IsZero() {
+		return "No premium requests used in " + periodLabel(r) + "."
+	}
+	now = now.UTC()
+	if r.Period.Year() == now.Year() && r.Period.Month() == now.Month() {
+		return "No premium requests used yet this month."
+	}
+	return "No premium requests used in " + r.Period.Format("January 2006") + "."
+}
+
+// boxWidth fits the box to w when it is a terminal.
+func boxWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return defaultBoxWidth
+	}
+	cols, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || cols <= 0 {
+		return defaultBoxWidth
+	}
+	return max(minBoxWidth, cols-boxMargin)
+}
+
+func drawBar(used, total float64, width int, g glyphs) string {
+	if total > 0 && used > total {
+		within := int(math.Round(total / used * float64(width)))
+		return strings.Repeat(g.barFull, within) + strings.Repeat(g.barOver, width-within)
+	}
+	filled := 0
+	if total > 0 {
+		filled = int((used / total) * float64(width))
+	}
 	if filled > width {
 		filled = width
 	}
 	empty := width - filled
-	return strings.Repeat("█", filled) + strings.Repeat("░", empty)
+	return strings.Repeat(g.barFull, filled) + strings.Repeat(g.barEmpty, empty)
+}
+
+// drawSplitBar draws included usage with barIncluded and billable usage
+// with barFull. Past the limit the bar is scaled to the total used and the
+// share over the limit is drawn with barOver, as in drawBar.
+func drawSplitBar(included, billable, total float64, width int, g glyphs) string {
+	included, billable = max(included, 0), max(billable, 0)
+	used := included + billable
+	scale := max(total, used)
+	if scale <= 0 {
+		return strings.Repeat(g.barEmpty, width)
+	}
+	within := width
+	if total > 0 && used > total {
+		within = int(math.Round(total / used * float64(width)))
+	}
+	inc := int(included / scale * float64(width))
+	filled := min(int(used/scale*float64(width)), width)
+
+	var b strings.Builder
+	for i := 0; i < width; i++ {
+		switch {
+		case i >= filled:
+			b.WriteString(g.barEmpty)
+		case i >= within:
+			b.WriteString(g.barOver)
+		case i < inc:
+			b.WriteString(g.barIncluded)
+		default:
+			b.WriteString(g.barFull)
+		}
+	}
+	return b.String()
 }
 
 func center(s string, width int) string {
-	if len(s) >= width {
-		return s[:width]
+	w := displayWidth(s)
+	if w > width {
+		return ellipsize(s, width)
 	}
-	padding := (width - len(s)) / 2
-	return strings.Repeat(" ", padding) + s + strings.Repeat(" ", width-len(s)-padding)
+	padding := (width - w) / 2
+	return strings.Repeat(" ", padding) + s + strings.Repeat(" ", width-w-padding)
 }
 
 func padRight(s string, width int) string {
-	if len(s) >= width {
-		return s[:width]
+	w := displayWidth(s)
+	if w > width {
+		return ellipsize(s, width)
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+func ellipsize(s string, width int) string {
+	e := boxGlyphs.ellipsis
+	ew := displayWidth(e)
+	if displayWidth(s) <= width || ew > width {
+		return truncateWidth(s, width)
+	}
+	return truncateWidth(strings.TrimRight(truncateWidth(s, width-ew), " ")+e, width)
+}
+
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+func truncateWidth(s string, w int) string {
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		if used+rw > w {
+			break
+		}
+		b.WriteRune(r)
+		used += rw
 	}
-	return s + strings.Repeat(" ", width-len(s))
+	return b.String() + strings.Repeat(" ", w-used)
 }
 
 func capitalize(s string) string {
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fakeRunner answers gh invocations from a table keyed by the full command
+// line and records every call.
+type fakeRunner struct {
+	outputs map[string]string
+	calls   []string
+}
+
+func (f *fakeRunner) Run(name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, cmd)
+	out, ok := f.outputs[cmd]
+	if !ok {
+		return nil, fmt.Errorf("unexpected command: %s", cmd)
+	}
+	return []byte(out), nil
+}
+
+func ghCommand(args []string) string {
+	return strings.Join(append([]string{"gh"}, args...), " ")
+}
+
+func TestFetchThroughRunner(t *testing.T) {
+	setupRender(t)
+	runner := &fakeRunner{outputs: map[string]string{
+		ghCommand(usernameArgs(defaultHost)): "octocat\n",
+		ghCommand(usageArgs(defaultHost, Account{Name: "octocat"}, 2025, 10, 0)): `{"usageItems":[` +
+			`{"model":"GPT-5","grossQuantity":40},{"model":"gpt-4o","grossQuantity":2.5}]}`,
+	}}
+	src := ghSource{runner: runner, host: defaultHost, retry: retryPolicy{attempts: 1}}
+
+	acct, err := resolveAccount(src, "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Name != "octocat" || acct.Org {
+		t.Fatalf("resolveAccount = %+v, want user octocat", acct)
+	}
+	opts := reportOptions{plan: "pro", limit: 300, period: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), order: "count"}
+	r, err := fetchReport(src, acct, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Used != 42.5 || len(r.Models) != 2 || r.Models[0].Model != "GPT-5" {
+		t.Errorf("report = used %v, models %+v", r.Used, r.Models)
+	}
+	if len(runner.calls) != 2 {
+		t.Errorf("gh was run %d times, want 2: %q", len(runner.calls), runner.calls)
+	}
+}
+
+func TestCalculateTotalUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []UsageItem
+		want  float64
+	}{
+		{"empty", nil, 0},
+		{"single", []UsageItem{{GrossQuantity: 12}}, 12},
+		{"fractional", []UsageItem{{GrossQuantity: 80.5}, {GrossQuantity: 41.2}, {GrossQuantity: 20}}, 141.7},
+		{"net is ignored", []UsageItem{{GrossQuantity: 10, NetQuantity: 4}}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateTotalUsage(tt.items); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("calculateTotalUsage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		cliPlan  string
+		cliLimit int
+		env      string
+		cfg      config
+		want     string
+		wantErr  bool
+	}{
+		{name: "nothing set", want: ""},
+		{name: "flag", cliPlan: "pro", env: "business", cfg: config{Plan: "free"}, want: "pro"},
+		{name: "unknown flag", cliPlan: "gold", wantErr: true},
+		{name: "unknown flag with limit", cliPlan: "gold", cliLimit: 50, want: "gold"},
+		{name: "env", env: "business", cfg: config{Plan: "free"}, want: "business"},
+		{name: "unknown env falls through", env: "gold", cfg: config{Plan: "free"}, want: "free"},
+		{name: "config", cfg: config{Plan: "enterprise"}, want: "enterprise"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GH_COPILOT_PLAN", tt.env)
+			got, err := getPlan(tt.cliPlan, tt.cliLimit, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPlan error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPlan = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		cliLimit int
+		cliSet   bool
+		env      string
+		plan     string
+		cfg      config
+		want     int
+		wantErr  bool
+	}{
+		{name: "flag", cliLimit: 50, cliSet: true, env: "70", cfg: config{Limit: 90}, want: 50},
+		{name: "env", env: "70", cfg: config{Limit: 90}, plan: "pro", want: 70},
+		{name: "bad env", env: "lots", wantErr: true},
+		{name: "config", cfg: config{Limit: 90}, plan: "pro", want: 90},
+		{name: "plan", plan: "pro", want: 300},
+		{name: "unknown plan", plan: "gold", want: 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GH_COPILOT_LIMIT", tt.env)
+			got, err := getLimit(tt.cliLimit, tt.cliSet, tt.plan, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getLimit error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  reportOptions
+		check func(t *testing.T, got JSONReport)
+	}{
+		{"totals", reportOptions{}, func(t *testing.T, got JSONReport) {
+			if got.Username != "octocat" || got.Plan != "pro" || got.Limit != 300 {
+				t.Errorf("header = %q %q %d", got.Username, got.Plan, got.Limit)
+			}
+			if got.Used != 141.7 || got.Percentage != 47.2 || got.Month != "October 2025" {
+				t.Errorf("used %v, percentage %v, month %q", got.Used, got.Percentage, got.Month)
+			}
+			if len(got.Models) != 3 || got.Models[0].Model != "Claude Sonnet 4" || got.Models[0].Count != 80.5 {
+				t.Errorf("models = %+v", got.Models)
+			}
+			if got.Others != nil || got.ProjectedUsed != nil {
+				t.Errorf("unexpected others %+v or projection %v", got.Others, got.ProjectedUsed)
+			}
+		}},
+		{"top and forecast", reportOptions{top: 1, forecast: true}, func(t *testing.T, got JSONReport) {
+			if len(got.Models) != 1 || got.Others == nil || got.Others.Models != 2 || got.Others.Count != 61.2 {
+				t.Errorf("models = %+v, others = %+v", got.Models, got.Others)
+			}
+			if got.ProjectedUsed == nil || *got.ProjectedUsed != 313.76 {
+				t.Errorf("projected_used = %v, want 313.76", got.ProjectedUsed)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRender(t)
+			r := testReport(t, "usage.json", tt.opts)
+			out := captureOutput(t, func(w io.Writer) error { return outputJSON(w, r, renderOptions{}) })
+			var got JSONReport
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, out)
+			}
+			tt.check(t, got)
+		})
+	}
+}
+
+// boxLines splits a rendered box into lines, failing unless every line has
+// the same display width.
+func boxLines(t *testing.T, out string) []string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	want := displayWidth(lines[0])
+	for i, line := range lines {
+		if w := displayWidth(line); w != want {
+			t.Errorf("line %d is %d columns wide, want %d:\n%s", i+1, w, want, out)
+		}
+	}
+	return lines
+}
+
+func TestBoxBorders(t *testing.T) {
+	for _, tt := range []struct {
+		golden string
+		g      glyphs
+	}{
+		{"box", unicodeGlyphs},
+		{"box-ascii", asciiGlyphs},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			setupRender(t)
+			boxGlyphs = tt.g
+			r := testReport(t, "usage.json", reportOptions{})
+			out := captureOutput(t, func(w io.Writer) error { return render(w, "box", r, renderOptions{}) })
+			checkGolden(t, tt.golden, out)
+
+			g := tt.g
+			lines := boxLines(t, out)
+			separators := 0
+			for i, line := range lines {
+				var left, right string
+				switch {
+				case i == 0:
+					left, right = g.topLeft, g.topRight
+				case i == len(lines)-1:
+					left, right = g.bottomLeft, g.bottomRight
+				case strings.HasPrefix(line, g.teeLeft) && strings.Contains(line, g.horiz+g.horiz):
+					left, right = g.teeLeft, g.teeRight
+					separators++
+				default:
+					left, right = g.vert, g.vert
+				}
+				if !strings.HasPrefix(line, left) || !strings.HasSuffix(line, right) {
+					t.Errorf("line %d = %q, want it framed by %q and %q", i+1, line, left, right)
+				}
+			}
+			if separators != 2 {
+				t.Errorf("found %d separators, want 2", separators)
+			}
+		})
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"octocat", 7},
+		{"日本語", 6},
+		{"GPT-5 🚀", 8},
+		{"cafe\u0301", 4},
+		{"modèle", 6},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.s); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestBoxAlignmentWideCharacters(t *testing.T) {
+	setupRender(t)
+	r := testReport(t, "wide.json", reportOptions{})
+	r.Username = "日本語"
+	out := captureOutput(t, func(w io.Writer) error { return render(w, "box", r, renderOptions{}) })
+	boxLines(t, out)
+	for _, want := range []string{"日本語", "GPT-5 🚀", "cafe\u0301"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("box is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCenter(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 7, "  abc  "},
+		{"abcd", 4, "abcd"},
+		{"abcdefgh", 5, "abcd…"},
+		{"日本語のタイトル", 9, "日本語の…"},
+	}
+	for _, tt := range tests {
+		got := center(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("center(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if w := displayWidth(got); w != tt.width {
+			t.Errorf("center(%q, %d) is %d columns wide", tt.s, tt.width, w)
+		}
+	}
+}
+
+func TestBoxLongTitle(t *testing.T) {
+	setupRender(t)
+	r := testReport(t, "usage.json", reportOptions{plan: "enterprise-plus-custom-agreement", limit: 1000})
+	out := captureOutput(t, func(w io.Writer) error { return render(w, "box", r, renderOptions{}) })
+	lines := boxLines(t, out)
+	title := strings.TrimSuffix(strings.TrimPrefix(lines[2], boxGlyphs.vert), boxGlyphs.vert)
+	if displayWidth(title) != defaultBoxWidth-2 || !strings.HasSuffix(strings.TrimRight(title, " "), "…") {
+		t.Errorf("title line = %q, want it ellipsized to the inner width", lines[2])
+	}
+	if !strings.HasPrefix(strings.TrimSpace(title), "GitHub Copilot Enterprise-plus") {
+		t.Errorf("title line = %q, want it to keep the start of the title", lines[2])
+	}
+}
+
+func TestPadRight(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"gpt-4o", 8, "gpt-4o  "},
+		{"gpt-4o", 6, "gpt-4o"},
+		{"Überlänge-Modell", 8, "Überlän…"},
+		{"模型名称很长", 7, "模型名…"},
+		{"模型名称很长", 8, "模型名… "},
+		{"ab🚀🚀cd", 5, "ab🚀…"},
+	}
+	for _, tt := range tests {
+		got := padRight(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("padRight(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if w := displayWidth(got); w != tt.width {
+			t.Errorf("padRight(%q, %d) is %d columns wide", tt.s, tt.width, w)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("padRight(%q, %d) = %q is not valid UTF-8", tt.s, tt.width, got)
+		}
+	}
+}
+
+func TestZeroLimitRenders(t *testing.T) {
+	for _, mode := range outputModes {
+		t.Run(mode, func(t *testing.T) {
+			setupRender(t)
+			r := testReport(t, "usage.json", reportOptions{plan: "custom", limit: 0, forecast: true})
+			out := captureOutput(t, func(w io.Writer) error {
+				return render(w, mode, r, renderOptions{barWidth: defaultBarWidth, bar: true})
+			})
+			if strings.TrimSpace(out) == "" {
+				t.Fatalf("%s output is empty", mode)
+			}
+			for _, bad := range []string{"NaN", "Inf"} {
+				if strings.Contains(out, bad) {
+					t.Errorf("%s output contains %s:\n%s", mode, bad, out)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLimitRejectsNonPositive(t *testing.T) {
+	t.Setenv("GH_COPILOT_LIMIT", "")
+	for _, limit := range []int{0, -5} {
+		if _, err := getLimit(limit, true, "pro", config{}); err == nil {
+			t.Errorf("getLimit(%d) succeeded, want an error", limit)
+		}
+	}
+	t.Setenv("GH_COPILOT_LIMIT", "0")
+	if _, err := getLimit(0, false, "pro", config{}); err == nil {
+		t.Error("GH_COPILOT_LIMIT=0 was accepted, want an error")
+	}
+}
+
+func TestFractionalCounts(t *testing.T) {
+	tests := []struct {
+		decimals int
+		overall  string
+		model    string
+	}{
+		{0, "Overall:  142/300 (47.2%)", "Claude Sonnet 4  81"},
+		{1, "Overall:  141.7/300 (47.2%)", "Claude Sonnet 4  80.5"},
+		{2, "Overall:  141.70/300 (47.2%)", "Claude Sonnet 4  80.50"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.decimals), func(t *testing.T) {
+			setupRender(t)
+			countDecimals = tt.decimals
+			r := testReport(t, "usage.json", reportOptions{})
+
+			box := captureOutput(t, func(w io.Writer) error { return render(w, "box", r, renderOptions{}) })
+			for _, want := range []string{tt.overall, tt.model} {
+				if !strings.Contains(box, want) {
+					t.Errorf("box is missing %q:\n%s", want, box)
+				}
+			}
+
+			var got JSONReport
+			if err := json.Unmarshal([]byte(captureOutput(t, func(w io.Writer) error { return outputJSON(w, r, renderOptions{}) })), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Used != 141.7 || got.Models[0].Count != 80.5 {
+				t.Errorf("JSON used = %v, first model = %v; want 141.7 and 80.5", got.Used, got.Models[0].Count)
+			}
+		})
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := []struct {
+		v        float64
+		decimals int
+		want     string
+	}{
+		{141.7, 0, "142"},
+		{141.4, 0, "141"},
+		{141.7, 1, "141.7"},
+		{0.05, 1, "0.1"},
+		{20, 2, "20.00"},
+	}
+	for _, tt := range tests {
+		old := countDecimals
+		countDecimals = tt.decimals
+		if got := formatCount(tt.v); got != tt.want {
+			t.Errorf("formatCount(%v) with %d decimals = %q, want %q", tt.v, tt.decimals, got, tt.want)
+		}
+		countDecimals = old
+	}
+}
+
+func TestModelRowsLongName(t *testing.T) {
+	const name = "claude-3-7-sonnet-thinking-v2x"
+	if len(name) != 30 {
+		t.Fatalf("fixture name is %d characters, want 30", len(name))
+	}
+	setupRender(t)
+	r := testReport(t, "long-model.json", reportOptions{plan: "pro+", limit: 1500})
+	out := captureOutput(t, func(w io.Writer) error { return render(w, "box", r, renderOptions{}) })
+	boxLines(t, out)
+	for _, want := range []string{name + "  1201", "GPT-5                             41", "gpt-4o                             3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("box is missing %q:\n%s", want, out)
+		}
+	}
+
+	// Too narrow for the full name: it is ellipsized, the counts survive.
+	for _, width := range []int{20, 30, 40} {
+		for i, row := range modelRows(r.Models, width, unicodeGlyphs) {
+			if w := displayWidth(row); w > width {
+				t.Errorf("width %d: row %q is %d columns wide", width, row, w)
+			}
+			if !strings.Contains(row, " "+formatCount(r.Models[i].Count)+" ") {
+				t.Errorf("width %d: row %q does not show count %s", width, row, formatCount(r.Models[i].Count))
+			}
+			if i == 0 && !strings.Contains(row, name) && !strings.Contains(row, "…") {
+				t.Errorf("width %d: row %q cut the name without an ellipsis", width, row)
+			}
+		}
+	}
+}
+
+func TestI3barQueriesUTCMonth(t *testing.T) {
+	setupRender(t)
+	clock = func() time.Time { return aheadOfUTC }
+	runner := &fakeRunner{outputs: map[string]string{
+		ghCommand(usageArgs(defaultHost, Account{Name: "octocat"}, 2025, 10, 0)): usagePage1,
+	}}
+	src := ghSource{runner: runner, host: defaultHost, retry: retryPolicy{attempts: 1}}
+	block := copilotBlock(src, plans["pro"], 0, i3barOptions{user: "octocat", width: defaultBarWidth})
+	if block["_used"] != 120.5 {
+		t.Errorf("block = %v, calls %q", block, runner.calls)
+	}
+}
+
+func TestUsageCacheFollowsClock(t *testing.T) {
+	setupRender(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	acct := Account{Name: "octocat"}
+	runner := &fakeRunner{outputs: map[string]string{
+		ghCommand(usageArgs(defaultHost, acct, 2025, 10, 0)): usagePage1,
+	}}
+	src := ghSource{runner: runner, host: defaultHost, retry: retryPolicy{attempts: 1}}
+	fetch := func() time.Time {
+		t.Helper()
+		_, fetched, err := fetchUsageCached(src, acct, 2025, 10, 0, 5*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fetched
+	}
+
+	fetch()
+	clock = func() time.Time { return goldenNow.Add(4 * time.Minute) }
+	if fetched := fetch(); !fetched.Equal(goldenNow) || len(runner.calls) != 1 {
+		t.Errorf("within the TTL: fetched %v after %d calls, want the cached %v", fetched, len(runner.calls), goldenNow)
+	}
+	clock = func() time.Time { return goldenNow.Add(6 * time.Minute) }
+	if fetched := fetch(); !fetched.Equal(goldenNow.Add(6*time.Minute)) || len(runner.calls) != 2 {
+		t.Errorf("past the TTL: fetched %v after %d calls, want a live fetch", fetched, len(runner.calls))
+	}
+}
+
+func TestNoModelsOutput(t *testing.T) {
+	for _, mode := range []string{"json", "yaml"} {
+		t.Run(mode, func(t *testing.T) {
+			setupRender(t)
+			r := testReport(t, "usage.json", reportOptions{})
+			out := captureOutput(t, func(w io.Writer) error { return render(w, mode, r, renderOptions{noModels: true}) })
+			if strings.Contains(out, "models") || strings.Contains(out, "GPT-5") {
+				t.Errorf("-no-models %s output still has models:\n%s", mode, out)
+			}
+			if !strings.Contains(out, "141.7") {
+				t.Errorf("-no-models %s output lost the total:\n%s", mode, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+const monthWorkers = 4
+
+type periodSummary struct {
+	Month      string  `json:"month"`
+	Used       float64 `json:"used"`
+	Limit      int     `json:"limit"`
+	Percentage float64 `json:"percentage"`
+}
+
+func fetchMonths(src UsageSource, acct Account, opts reportOptions, n int) ([]Report, error) {
+	reports := make([]Report, n)
+	errs := make([]error, n)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, monthWorkers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				period := opts.period.AddDate(0, i-(n-1), 0)
+				usage, _, err := fetchUsageCached(src, acct, period.Year(), int(period.Month()), 0, opts.ttl)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %w", period.Format("2006-01"), usageError(acct, err))
+					continue
+				}
+				reports[i] = buildReport(acct, period, usage, opts)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+type yearSummary struct {
+	Year   int             `json:"year"`
+	Total  float64         `json:"total"`
+	Months []periodSummary `json:"months"`
+}
+
+func summarize(reports []Report) []periodSummary {
+	summaries := make([]periodSummary, len(reports))
+	for i, r := range reports {
+		summaries[i] = periodSummary{
+			Month:      r.Period.Format("2006-01"),
+			Used:       math.Round(r.Used*100) / 100,
+			Limit:      r.Limit,
+			Percentage: roundPct(r.Percentage),
+		}
+	}
+	return summaries
+}
+
+func outputYear(w io.Writer, year int, reports []Report, mode string, compact bool) error {
+	var total float64
+	for _, r := range reports {
+		total += r.Used
+	}
+	if mode == "json" {
+		enc := json.NewEncoder(w)
+		if !compact {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(yearSummary{Year: year, Total: math.Round(total*100) / 100, Months: summarize(reports)})
+	}
+
+	fmt.Fprintf(w, "%-14s %10s %8s\n", "MONTH", "USED", "%")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%-14s %10s %7s%%\n", r.Period.Format("January"), formatCount(r.Used), formatPct(r.Percentage))
+	}
+	fmt.Fprintf(w, "%-14s %10s\n", fmt.Sprintf("Total %d", year), formatCount(total))
+	return nil
+}
+
+func outputMonths(w io.Writer, reports []Report, mode string, compact bool) error {
+	if mode == "json" {
+		enc := json.NewEncoder(w)
+		if !compact {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(summarize(reports))
+	}
+
+	var total, totalPct float64
+	fmt.Fprintf(w, "%-14s %10s %8s\n", "MONTH", "USED", "%")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%-14s %10s %7s%%\n", r.Period.Format("January 2006"), formatCount(r.Used), formatPct(r.Percentage))
+		total += r.Used
+		totalPct += r.Percentage
+	}
+	n := float64(len(reports))
+	fmt.Fprintf(w, "%-14s %10s %7s%%\n", "Average", formatCount(total/n), formatPct(totalPct/n))
+	return nil
+}
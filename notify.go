@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const notifyTitle = "GitHub Copilot usage"
+
+type notifier struct {
+	threshold float64
+	command   string
+	host      string
+}
+
+type notifyState struct {
+	Month string `json:"month"`
+	Above bool   `json:"above"`
+}
+
+func (n *notifier) check(r Report) {
+	if n == nil {
+		return
+	}
+	name := "notify-" + r.Username
+	if r.Org {
+		name = "notify-org-" + r.Username
+	}
+	name = hostCacheName(n.host, name)
+	var prev notifyState
+	readCacheEntry(name, &prev)
+
+	state := notifyState{Month: r.Period.Format("2006-01"), Above: r.Percentage >= n.threshold}
+	if state == prev {
+		return
+	}
+	writeCache(name, state)
+	if !state.Above || (prev.Month == state.Month && prev.Above) {
+		return
+	}
+
+	msg := fmt.Sprintf("%s has used %s of %d premium requests (%s%%) in %s",
+		r.Username, formatCount(r.Used), r.Limit, formatPct(r.Percentage), periodLabel(r))
+	if err := n.send(msg); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not send notification:", err)
+	}
+}
+
+func (n *notifier) send(msg string) error {
+	var cmd *exec.Cmd
+	switch {
+	case strings.TrimSpace(n.command) != "":
+		fields := strings.Fields(n.command)
+		cmd = exec.Command(fields[0], append(fields[1:], notifyTitle, msg)...)
+	case runtime.GOOS == "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", msg, notifyTitle)
+		cmd = exec.Command("osascript", "-e", script)
+	case runtime.GOOS == "windows":
+		return errors.New("no default notifier on Windows; set -notify-cmd")
+	default:
+		cmd = exec.Command("notify-send", notifyTitle, msg)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeOutput runs print with its output going to path. The output is
+// written to a temporary file in the same directory and renamed into place
+// only once it has been written, synced and closed, so readers such as the
+// Prometheus textfile collector never see a partial file. An empty path
+// prints to stdout as usual.
+func writeOutput(path string, print func(w io.Writer) error) error {
+	if path == "" {
+		return print(os.Stdout)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	// bufio keeps the first write error, so Flush reports failures from
+	// renderers that ignore the result of each print.
+	bw := bufio.NewWriter(f)
+	err = print(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// writeLine prints a line for -i3bar. EPIPE means i3bar has gone away, so
+// exit cleanly rather than keep writing into a closed pipe.
+func writeLine(s string) {
+	if _, err := fmt.Println(s); errors.Is(err, syscall.EPIPE) {
+		os.Exit(exitOK)
+	}
+	os.Stdout.Sync()
+}
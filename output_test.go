@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "copilot.prom")
+	if err := writeOutput(path, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "first")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	errRender := errors.New("render failed")
+	if err := writeOutput(path, func(w io.Writer) error {
+		fmt.Fprintln(w, "partial")
+		return errRender
+	}); !errors.Is(err, errRender) {
+		t.Fatalf("writeOutput = %v, want %v", err, errRender)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\n" {
+		t.Errorf("%s = %q after a failed write, want the previous output", path, data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files left in %s, want only the output", len(entries), dir)
+	}
+}
+
+func TestWriteOutputTemplateError(t *testing.T) {
+	setupRender(t)
+	tmpl, err := parseTemplate("{{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "usage.txt")
+	r := testReport(t, "usage.json", reportOptions{})
+	if err := writeOutput(path, func(w io.Writer) error {
+		return render(w, "template", r, renderOptions{template: tmpl})
+	}); err == nil {
+		t.Fatal("writeOutput succeeded with a failing template")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in %s after a template error", len(entries), dir)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = 500 * time.Millisecond
+)
+
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+}
+
+func getRetries(cliRetries int) int {
+	if cliRetries > 0 {
+		return cliRetries
+	}
+	if envRetries := os.Getenv("GH_COPILOT_RETRIES"); envRetries != "" {
+		if parsed, err := strconv.Atoi(envRetries); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultRetries
+}
+
+func (p retryPolicy) run(fn func() error) error {
+	delay := p.delay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.attempts || !retryable(err) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Attempt %d/%d failed: %v (retrying in %s)\n", attempt, p.attempts, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryable reports whether err is worth another attempt. Timeouts are not
+// retried on either path, so -timeout bounds how long a refresh can block.
+func retryable(err error) bool {
+	if _, ok := err.(*timeoutError); ok {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	if httpErr, ok := err.(*httpError); ok {
+		return httpErr.StatusCode >= 500
+	}
+	return !strings.Contains(err.Error(), "(HTTP 4")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryableTimeouts(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Timeout = 20 * time.Millisecond
+	s := &apiSource{host: "example.com", client: client}
+	policy := retryPolicy{attempts: 3, delay: time.Millisecond}
+
+	err := policy.run(func() error {
+		_, _, err := s.fetch(srv.URL + "/user")
+		return err
+	})
+	if err == nil {
+		t.Fatal("fetch succeeded, want a timeout")
+	}
+	if retryable(err) {
+		t.Errorf("retryable(%v) = true, want false", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&httpError{StatusCode: 502}, true},
+		{&httpError{StatusCode: 404}, false},
+		{&timeoutError{}, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
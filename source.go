@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHost    = "github.com"
+	defaultTimeout = 10 * time.Second
+)
+
+type Runner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+type execRunner struct {
+	timeout time.Duration
+	env     []string
+}
+
+func (r execRunner) Run(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = time.Second
+	cmd.Env = r.env
+	vlog.Printf("exec %q", cmd.Args)
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		vlog.Printf("%s timed out after %s", name, r.timeout)
+		return nil, &timeoutError{after: r.timeout}
+	}
+	vlog.Printf("%s finished in %s (%d bytes, err=%v)", name, time.Since(start).Round(time.Millisecond), len(out), err)
+	return out, err
+}
+
+type timeoutError struct {
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("gh did not respond within %s (see -timeout)", e.after)
+}
+
+type UsageSource interface {
+	Host() string
+	Username() (string, error)
+	Usage(acct Account, year, month, day int) (UsageResponse, error)
+	Plan(acct Account) (string, error)
+}
+
+var errNoPlanEndpoint = errors.New("the Copilot plan can only be detected for organizations")
+
+func planEndpoint(acct Account) (string, error) {
+	if !acct.Org {
+		return "", errNoPlanEndpoint
+	}
+	return "/orgs/" + acct.Name + "/copilot/billing", nil
+}
+
+type Account struct {
+	Name string
+	Org  bool
+}
+
+func resolveAccount(src UsageSource, org, user string, ttl time.Duration) (Account, error) {
+	if org != "" {
+		return Account{Name: org, Org: true}, nil
+	}
+	if user != "" {
+		return Account{Name: user}, nil
+	}
+	username, err := getUsernameCached(src, ttl)
+	if err != nil {
+		return Account{}, err
+	}
+	return Account{Name: username}, nil
+}
+
+func isNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func isForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+func hasStatus(err error, code int) bool {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == code
+	}
+	return strings.Contains(err.Error(), fmt.Sprintf("(HTTP %d)", code))
+}
+
+type httpError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+func getHost(cliHost string) string {
+	if cliHost != "" {
+		return cliHost
+	}
+	if envHost := os.Getenv("GH_HOST"); envHost != "" {
+		return envHost
+	}
+	return defaultHost
+}
+
+func apiBaseURL(host string) string {
+	switch {
+	case host == defaultHost:
+		return "https://api.github.com"
+	case strings.HasSuffix(host, ".ghe.com"):
+		return "https://api." + host
+	}
+	return "https://" + host + "/api/v3"
+}
+
+func billingURL(host string, acct Account) string {
+	if acct.Org {
+		return "https://" + host + "/organizations/" + acct.Name + "/settings/billing"
+	}
+	return "https://" + host + "/settings/billing"
+}
+
+type ghAuth struct {
+	user      string
+	configDir string
+}
+
+func (a ghAuth) runner(host string, timeout time.Duration) (execRunner, error) {
+	runner := execRunner{timeout: timeout}
+	if a.configDir == "" && a.user == "" {
+		return runner, nil
+	}
+	runner.env = os.Environ()
+	if a.configDir != "" {
+		runner.env = append(runner.env, "GH_CONFIG_DIR="+a.configDir)
+	}
+	if a.user != "" {
+		out, err := runner.Run("gh", a.tokenArgs(host)...)
+		token := strings.TrimSpace(string(out))
+		if err != nil {
+			if token != "" {
+				return runner, fmt.Errorf("could not get a token for gh user %q: %s", a.user, token)
+			}
+			return runner, fmt.Errorf("could not get a token for gh user %q: %w", a.user, err)
+		}
+		runner.env = append(runner.env, "GH_TOKEN="+token)
+	}
+	return runner, nil
+}
+
+func (a ghAuth) tokenArgs(host string) []string {
+	args := []string{"auth", "token", "--user", a.user}
+	if host != defaultHost {
+		args = append(args, "--hostname", host)
+	}
+	return args
+}
+
+func newUsageSource(noGH bool, host string, retry retryPolicy, timeout time.Duration, auth ghAuth) (UsageSource, error) {
+	if !noGH {
+		if _, err := exec.LookPath("gh"); err == nil {
+			runner, err := auth.runner(host, timeout)
+			if err != nil {
+				return nil, err
+			}
+			return ghSource{runner: runner, host: host, retry: retry}, nil
+		}
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	if token == "" && noGH {
+		return nil, errors.New("-no-gh needs a token: set GITHUB_TOKEN or GH_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("GitHub CLI (gh) was not found on PATH.\n" +
+			"Install it from https://cli.github.com and run `gh auth login`,\n" +
+			"or set GITHUB_TOKEN to call the GitHub API directly")
+	}
+	return &apiSource{
+		host:   host,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+		retry:  retry,
+	}, nil
+}
+
+type ghSource struct {
+	runner Runner
+	host   string
+	retry  retryPolicy
+}
+
+func (s ghSource) Host() string {
+	return s.host
+}
+
+func (s ghSource) Username() (string, error) {
+	return getUsername(s.runner, s.host)
+}
+
+func (s ghSource) Usage(acct Account, year, month, day int) (UsageResponse, error) {
+	return fetchUsage(s.runner, s.host, acct, year, month, day, s.retry)
+}
+
+func (s ghSource) Plan(acct Account) (string, error) {
+	path, err := planEndpoint(acct)
+	if err != nil {
+		return "", err
+	}
+	out, err := s.runner.Run("gh", ghAPIArgs(s.host, path, "-q", ".plan_type")...)
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func usernameArgs(host string) []string {
+	return ghAPIArgs(host, "/user", "-q", ".login")
+}
+
+func usageArgs(host string, acct Account, year, month, day int) []string {
+	return ghAPIArgs(host, "--paginate", usageEndpoint(acct, year, month, day))
+}
+
+func ghAPIArgs(host string, args ...string) []string {
+	if host != defaultHost {
+		args = append([]string{"--hostname", host}, args...)
+	}
+	return append([]string{"api"}, args...)
+}
+
+type fileSource struct {
+	path  string
+	host  string
+	mu    sync.Mutex
+	usage *UsageResponse
+}
+
+func (s *fileSource) Host() string {
+	return s.host
+}
+
+func (s *fileSource) Username() (string, error) {
+	usage, err := s.Usage(Account{}, 0, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	if usage.User == "" {
+		return "local", nil
+	}
+	return usage.User, nil
+}
+
+func (s *fileSource) Usage(acct Account, year, month, day int) (UsageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage != nil {
+		return *s.usage, nil
+	}
+	var data []byte
+	var err error
+	if s.path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(s.path)
+	}
+	if err != nil {
+		return UsageResponse{}, err
+	}
+	usage, err := decodeUsagePages(data)
+	if err != nil {
+		return UsageResponse{}, fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.usage = &usage
+	return usage, nil
+}
+
+func (s *fileSource) Plan(acct Account) (string, error) {
+	return "", errors.New("plan detection is not available with -input")
+}
+
+type apiSource struct {
+	host   string
+	token  string
+	client *http.Client
+	retry  retryPolicy
+}
+
+func (s *apiSource) Host() string {
+	return s.host
+}
+
+func (s *apiSource) Username() (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := s.get("/user", &user); err != nil {
+		return "", fmt.Errorf("could not get username: %w", err)
+	}
+	if user.Login == "" {
+		return "", fmt.Errorf("could not get username: empty response")
+	}
+	return user.Login, nil
+}
+
+func (s *apiSource) Usage(acct Account, year, month, day int) (UsageResponse, error) {
+	var usage UsageResponse
+	for path := usageEndpoint(acct, year, month, day); path != ""; {
+		var body []byte
+		var header http.Header
+		err := s.retry.run(func() error {
+			var err error
+			body, header, err = s.fetch(path)
+			return err
+		})
+		if err != nil {
+			return UsageResponse{}, err
+		}
+		page, err := decodeUsage(body)
+		if err != nil {
+			return UsageResponse{}, err
+		}
+		if usage.User == "" {
+			usage.User = page.User
+		}
+		usage.UsageItems = append(usage.UsageItems, page.UsageItems...)
+		path = nextPage(header.Get("Link"))
+	}
+	return usage, nil
+}
+
+// nextPage returns the rel="next" URL from a Link header, or "" on the last page.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(part, ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(target), "<>")
+	}
+	return ""
+}
+
+func (s *apiSource) Plan(acct Account) (string, error) {
+	path, err := planEndpoint(acct)
+	if err != nil {
+		return "", err
+	}
+	var billing struct {
+		PlanType string `json:"plan_type"`
+	}
+	if err := s.get(path, &billing); err != nil {
+		return "", err
+	}
+	return billing.PlanType, nil
+}
+
+func (s *apiSource) get(path string, v interface{}) error {
+	body, _, err := s.fetch(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (s *apiSource) fetch(path string) ([]byte, http.Header, error) {
+	url := path
+	if !strings.HasPrefix(url, "https://") {
+		url = apiBaseURL(s.host) + path
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "copilot-usage/"+version)
+
+	vlog.Printf("GET %s", req.URL)
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	vlog.Printf("GET %s: %s in %s", req.URL, resp.Status, time.Since(start).Round(time.Millisecond))
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		msg := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			msg = apiErr.Message
+		}
+		return nil, nil, &httpError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return body, resp.Header, nil
+}
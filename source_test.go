@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	usagePage1 = `{"user":"octocat","usageItems":[{"model":"GPT-5","grossQuantity":100},{"model":"gpt-4o","grossQuantity":20.5}]}`
+	usagePage2 = `{"user":"octocat","usageItems":[{"model":"GPT-5","grossQuantity":21.2}]}`
+)
+
+func TestDecodeUsagePages(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		items int
+		total float64
+	}{
+		{"single page", usagePage1, 2, 120.5},
+		{"two pages", usagePage1 + "\n" + usagePage2, 3, 141.7},
+		{"two pages without a separator", usagePage1 + usagePage2, 3, 141.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := decodeUsagePages([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(usage.UsageItems) != tt.items {
+				t.Errorf("got %d items, want %d", len(usage.UsageItems), tt.items)
+			}
+			if total := calculateTotalUsage(usage.UsageItems); math.Abs(total-tt.total) > 1e-9 {
+				t.Errorf("total = %v, want %v", total, tt.total)
+			}
+		})
+	}
+}
+
+func TestFetchUsagePaginatedGH(t *testing.T) {
+	acct := Account{Name: "octocat"}
+	runner := &fakeRunner{outputs: map[string]string{
+		ghCommand(usageArgs(defaultHost, acct, 2025, 10, 0)): usagePage1 + "\n" + usagePage2 + "\n",
+	}}
+	usage, err := fetchUsage(runner, defaultHost, acct, 2025, 10, 0, retryPolicy{attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(runner.calls[0], "--paginate") {
+		t.Errorf("gh was run without --paginate: %s", runner.calls[0])
+	}
+	if total := calculateTotalUsage(usage.UsageItems); math.Abs(total-141.7) > 1e-9 {
+		t.Errorf("total = %v, want 141.7", total)
+	}
+}
+
+func TestAPISourceFollowsLinkHeader(t *testing.T) {
+	var requests []string
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, usagePage2)
+			return
+		}
+		next := srv.URL + r.URL.Path + "?" + r.URL.RawQuery + "&page=2"
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s>; rel="last"`, next, next))
+		fmt.Fprint(w, usagePage1)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	s := &apiSource{host: host, token: "test-token", client: srv.Client(), retry: retryPolicy{attempts: 1}}
+	usage, err := s.Usage(Account{Name: "octocat"}, 2025, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("server saw %d requests, want 2: %q", len(requests), requests)
+	}
+	if want := "/api/v3" + usageEndpoint(Account{Name: "octocat"}, 2025, 10, 0); requests[0] != want {
+		t.Errorf("first request = %s, want %s", requests[0], want)
+	}
+	if total := calculateTotalUsage(usage.UsageItems); math.Abs(total-141.7) > 1e-9 {
+		t.Errorf("total = %v, want 141.7", total)
+	}
+	if usage.User != "octocat" {
+		t.Errorf("user = %q, want octocat", usage.User)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"", ""},
+		{`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{`<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=1>; rel="first"`, ""},
+	}
+	for _, tt := range tests {
+		if got := nextPage(tt.link); got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
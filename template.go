@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"text/template"
+)
+
+// templateFuncs are available to -template in addition to the text/template
+// builtins such as printf.
+var templateFuncs = template.FuncMap{
+	"bar": func(pct float64, width ...int) string {
+		w := defaultBarWidth
+		if len(width) > 0 {
+			w = width[0]
+		}
+		return drawBar(pct, 100, w, boxGlyphs)
+	},
+	"pct":   formatPct,
+	"count": formatCount,
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("template").Funcs(templateFuncs).Parse(text)
+}
+
+func outputTemplate(w io.Writer, r Report, tmpl *template.Template) error {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, r); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const releaseRepo = "lopezlav/copilot-usage"
+
+func latestRelease(timeout time.Duration) (string, error) {
+	path := "/repos/" + releaseRepo + "/releases/latest"
+	if _, err := exec.LookPath("gh"); err == nil {
+		out, err := execRunner{timeout: timeout}.Run("gh", ghAPIArgs(defaultHost, path, "-q", ".tag_name")...)
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return "", errors.New(msg)
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest(http.MethodGet, apiBaseURL(defaultHost)+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "copilot-usage/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &httpError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+func checkUpdate(timeout time.Duration) {
+	tag, err := latestRelease(timeout)
+	if err == nil && tag == "" {
+		err = errors.New("no release found")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not check for updates:", err)
+		return
+	}
+	if compareVersions(tag, version) > 0 {
+		fmt.Printf("copilot-usage %s is available (you have %s): https://github.com/%s/releases/latest\n",
+			strings.TrimPrefix(tag, "v"), version, releaseRepo)
+		return
+	}
+	fmt.Printf("copilot-usage %s is up to date\n", version)
+}
+
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] > pb[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) [3]int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts [3]int
+	for i, field := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const clearScreen = "\033[H\033[2J"
+
+func runWatch(src UsageSource, acct Account, ropts reportOptions, mode string, vopts renderOptions, interval time.Duration, notify *notifier) {
+	if ropts.ttl <= 0 {
+		ropts.ttl = max(interval, statusRefresh)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	// SIGPIPE means whatever reads our output has gone away.
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGPIPE)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *Report
+	for {
+		report, err := fetchReport(src, acct, ropts)
+		if err == nil {
+			last = &report
+			notify.check(report)
+		} else if last != nil {
+			last.Stale = true
+		}
+
+		if mode != "ndjson" {
+			fmt.Print(clearScreen)
+		}
+		if last != nil {
+			if err := render(os.Stdout, mode, *last, vopts); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "Error fetching usage:", err)
+		}
+
+		select {
+		case <-sigs:
+			return
+		case <-ticker.C:
+		}
+	}
+}